@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// accessCounter collects resource loads in memory and writes them in
+// batches, so that counting does not turn every read into a write.
+type accessCounter struct {
+	mu      sync.Mutex
+	batch   int
+	n       int
+	pending map[string]int64
+}
+
+// countAccess records a load of id, flushing the pending counts once a batch
+// is complete.
+func (a *Archive) countAccess(id string) error {
+	c := a.access
+	c.mu.Lock()
+	c.pending[id]++
+	c.n++
+	full := c.n >= c.batch
+	c.mu.Unlock()
+	if full {
+		return a.FlushAccessCounts()
+	}
+	return nil
+}
+
+// FlushAccessCounts writes the pending access counts to the database.
+func (a *Archive) FlushAccessCounts() error {
+	if a.access == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ctx, cancel := a.context()
+	defer cancel()
+	return a.translate(ctx, a.flushAccessCounts(ctx))
+}
+
+func (a *Archive) flushAccessCounts(ctx context.Context) error {
+	c := a.access
+	c.mu.Lock()
+	pending := c.pending
+	c.pending, c.n = map[string]int64{}, 0
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	err := transact(ctx, a.db, func(tx *sql.Tx) error {
+		for id, n := range pending {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO ACCESS (ID, COUNT) SELECT ID, ? FROM RESOURCES WHERE ID = ? ON CONFLICT (ID) DO UPDATE SET COUNT = COUNT + EXCLUDED.COUNT;`, n, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// keep the counts for the next attempt
+		c.mu.Lock()
+		for id, n := range pending {
+			c.pending[id] += n
+			c.n += int(n)
+		}
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// AccessCount returns how often a resource has been loaded since access
+// counting was enabled with WithAccessCounting.
+func (a *Archive) AccessCount(id string) (int64, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	var n int64
+	err := a.db.QueryRowContext(ctx, `SELECT IFNULL((SELECT COUNT FROM ACCESS WHERE ID = ?), 0) FROM RESOURCES WHERE ID = ?;`, id, id).Scan(&n)
+	if err != nil {
+		return 0, a.translate(ctx, err)
+	}
+	if a.access != nil {
+		a.access.mu.Lock()
+		n += a.access.pending[id]
+		a.access.mu.Unlock()
+	}
+	return n, nil
+}
+
+// TopAccessed lists the n most often loaded resources, most popular first.
+func (a *Archive) TopAccessed(n int) ([]Descriptor, error) {
+	if err := a.FlushAccessCounts(); err != nil {
+		return nil, err
+	}
+	return a.queryDescriptors(`SELECT R.ID, R.ATTRIBUTES FROM ACCESS A JOIN RESOURCES R ON R.ID = A.ID ORDER BY A.COUNT DESC, R.ID LIMIT ?;`, n)
+}
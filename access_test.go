@@ -0,0 +1,53 @@
+package archive
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAccessCounting(t *testing.T) {
+	a, err := Open(":memory:", WithAccessCounting(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, id := range []string{"/a", "/b", "/c"} {
+		a.Store(TextPlain(id, id))
+	}
+	loads := map[string]int{"/a": 2, "/b": 5, "/c": 1}
+	for id, n := range loads {
+		for i := 0; i < n; i++ {
+			a.Load(id)
+		}
+	}
+	NewHandler(a).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a", nil))
+
+	var stored int
+	a.db.QueryRow(`SELECT COUNT(*) FROM ACCESS;`).Scan(&stored)
+	if stored != 0 {
+		t.Fatalf("expected counts to be batched but %d were written", stored)
+	}
+	if err := a.FlushAccessCounts(); err != nil {
+		t.Fatalf("expected flush to succeed: %s", err)
+	}
+	for id, want := range map[string]int64{"/a": 3, "/b": 5, "/c": 1} {
+		if got, err := a.AccessCount(id); err != nil || got != want {
+			t.Fatalf("expected %d accesses of %s but got %d: %v", want, id, got, err)
+		}
+	}
+
+	ds, err := a.TopAccessed(2)
+	if err != nil {
+		t.Fatalf("expected top accessed to succeed: %s", err)
+	}
+	var got []string
+	for _, d := range ds {
+		got = append(got, d.ID)
+	}
+	if want := []string{"/b", "/a"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+}
@@ -0,0 +1,29 @@
+package archive
+
+import "context"
+
+type actorKey struct{}
+
+// ContextWithActor returns a context that makes StoreContext record actor as
+// the writer of a resource.
+func ContextWithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFromContext(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok
+}
+
+// stamp records the time of a write and, if known, its actor.
+func (a *Archive) stamp(ctx context.Context, as Attributes) {
+	as[AttributeLastModified] = a.timestamp()
+	delete(as, AttributeLastModifiedBy)
+	actor, ok := ActorFromContext(ctx)
+	if !ok {
+		actor = a.actor
+	}
+	if actor != "" {
+		as[AttributeLastModifiedBy] = actor
+	}
+}
@@ -0,0 +1,43 @@
+package archive
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLastModifiedBy(t *testing.T) {
+	a, err := Open(":memory:", WithActor("service"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ctx := ContextWithActor(context.Background(), "alice")
+	tests := []struct {
+		name  string
+		store func() error
+		as    func() (Attributes, error)
+		actor string
+	}{
+		{name: "context", store: func() error { return a.StoreContext(ctx, TextPlain("/a", "a")) }, as: func() (Attributes, error) { return a.Attributes("/a") }, actor: "alice"},
+		{name: "option", store: func() error { return a.Store(TextPlain("/b", "b")) }, as: func() (Attributes, error) { return a.Attributes("/b") }, actor: "service"},
+		{name: "none", store: func() error { return b.Store(MakeResource("/c", Attributes{AttributeLastModifiedBy: "forged"}, nil)) }, as: func() (Attributes, error) { return b.Attributes("/c") }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.store(); err != nil {
+				t.Fatalf("expected store to succeed: %s", err)
+			}
+			as, _ := test.as()
+			got, ok := as[AttributeLastModifiedBy]
+			if got != test.actor || ok != (test.actor != "") {
+				t.Fatalf("expected actor %q but got %q", test.actor, got)
+			}
+		})
+	}
+}
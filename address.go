@@ -0,0 +1,33 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+)
+
+// StoreContentAddressed stores data under an ID derived from its checksum,
+// such as "/sha256/2cf24d…", and returns that ID. Storing data that is
+// already present writes nothing and leaves the revision as is, so the
+// stored resources are deduplicated by construction.
+func (a *Archive) StoreContentAddressed(as Attributes, data []byte) (string, error) {
+	if err := a.writable(); err != nil {
+		return "", err
+	}
+	sum := Checksum(data)
+	algo, digest := splitChecksum(sum)
+	id := "/" + algo + "/" + digest
+	err := a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		ok, err := exists(ctx, tx, id)
+		if err != nil || ok {
+			return err
+		}
+		if err := a.put(ctx, tx, id, as, data, sum); err != nil {
+			return err
+		}
+		return bumpRevision(ctx, tx)
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
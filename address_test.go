@@ -0,0 +1,46 @@
+package archive
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStoreContentAddressed(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	as := Attributes{AttributeType: TypeTextPlain}
+	id, err := a.StoreContentAddressed(as, []byte("hello"))
+	if err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+	if want := "/sha256/2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"; id != want {
+		t.Fatalf("expected id %s but got %s", want, id)
+	}
+	rev := a.Revision()
+
+	again, err := a.StoreContentAddressed(Attributes{AttributeLabel: "ignored"}, []byte("hello"))
+	if err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+	if again != id {
+		t.Fatalf("expected id %s but got %s", id, again)
+	}
+	if got := a.Revision(); got != rev {
+		t.Fatalf("expected revision %d but got %d", rev, got)
+	}
+	if stored, _ := a.Attributes(id); stored.Has(AttributeLabel) {
+		t.Fatalf("expected no second write but got %v", stored)
+	}
+
+	other, _ := a.StoreContentAddressed(as, []byte("world"))
+	if other == id || !strings.HasPrefix(other, "/sha256/") {
+		t.Fatalf("expected a distinct id but got %s", other)
+	}
+	if got := a.Revision(); got != rev+1 {
+		t.Fatalf("expected revision %d but got %d", rev+1, got)
+	}
+}
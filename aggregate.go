@@ -0,0 +1,173 @@
+package archive
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Aggregate summarizes a group of resources.
+type Aggregate struct {
+	Count      int
+	TotalBytes int64
+}
+
+// AggregateByAttribute groups the resources by their value for key and
+// summarizes each group. Resources lacking key are grouped under "".
+func (a *Archive) AggregateByAttribute(key string) (map[string]Aggregate, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	rows, err := a.reader().QueryContext(ctx, `SELECT ATTRIBUTES, SIZE FROM RESOURCES;`)
+	if err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	defer rows.Close()
+	res := map[string]Aggregate{}
+	for rows.Next() {
+		var attributes string
+		var size int64
+		if err := rows.Scan(&attributes, &size); err != nil {
+			return nil, a.translate(ctx, err)
+		}
+		as, err := ParseAttributes(attributes)
+		if err != nil {
+			return nil, err
+		}
+		g := res[as[key]]
+		g.Count++
+		g.TotalBytes += size
+		res[as[key]] = g
+	}
+	if err := rows.Err(); err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	return res, nil
+}
+
+// Stats describes the size and content of an archive.
+type Stats struct {
+	// Count is the number of resources and TotalBytes the sum of their
+	// Length.
+	Count      int
+	TotalBytes int64
+	// DiskBytes is the size of the database, without external data files.
+	DiskBytes int64
+	// ByType summarizes the resources grouped by their Type. Resources
+	// lacking a Type are grouped under "".
+	ByType map[string]Aggregate
+}
+
+// Stats returns the size and content of the archive. It is computed by the
+// database from the SIZE and ATTRIBUTES columns, without reading any data.
+func (a *Archive) Stats() (Stats, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	db := a.reader()
+	var s Stats
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*), IFNULL(SUM(SIZE), 0) FROM RESOURCES;`).Scan(&s.Count, &s.TotalBytes); err != nil {
+		return Stats{}, a.translate(ctx, err)
+	}
+	var pages, pageSize int64
+	if err := db.QueryRowContext(ctx, `PRAGMA page_count;`).Scan(&pages); err != nil {
+		return Stats{}, a.translate(ctx, err)
+	}
+	if err := db.QueryRowContext(ctx, `PRAGMA page_size;`).Scan(&pageSize); err != nil {
+		return Stats{}, a.translate(ctx, err)
+	}
+	s.DiskBytes = pages * pageSize
+	// attributes are stored as lines of "Key: Value", so the type is what
+	// follows the line start "Type: " up to the end of the line
+	rows, err := db.QueryContext(ctx, `
+		WITH LINES (A, SIZE) AS (
+			SELECT CHAR(10) || REPLACE(ATTRIBUTES, CHAR(13), '') || CHAR(10), SIZE FROM RESOURCES
+		), STARTS (A, P, SIZE) AS (
+			SELECT A, INSTR(A, ?1), SIZE FROM LINES
+		)
+		SELECT CASE WHEN P = 0 THEN '' ELSE SUBSTR(A, P + LENGTH(?1), INSTR(SUBSTR(A, P + LENGTH(?1)), CHAR(10)) - 1) END AS TYPE, COUNT(*), SUM(SIZE)
+		FROM STARTS GROUP BY TYPE;`, "\n"+AttributeType+": ")
+	if err != nil {
+		return Stats{}, a.translate(ctx, err)
+	}
+	defer rows.Close()
+	s.ByType = map[string]Aggregate{}
+	for rows.Next() {
+		var t string
+		var g Aggregate
+		if err := rows.Scan(&t, &g.Count, &g.TotalBytes); err != nil {
+			return Stats{}, a.translate(ctx, err)
+		}
+		s.ByType[t] = g
+	}
+	if err := rows.Err(); err != nil {
+		return Stats{}, a.translate(ctx, err)
+	}
+	return s, nil
+}
+
+// TenantUsage sums the data bytes of the resources grouped by the first
+// segment of their IDs when split on delimiter, ignoring a leading delimiter,
+// so "/t1/a" and "/t1/b" both count towards "t1". The sums are computed by
+// the database from the SIZE column.
+func (a *Archive) TenantUsage(delimiter string) (map[string]int64, error) {
+	if delimiter == "" {
+		return nil, fmt.Errorf("archive: empty delimiter")
+	}
+	ctx, cancel := a.context()
+	defer cancel()
+	rows, err := a.reader().QueryContext(ctx, `
+		WITH PATHS (REST, SIZE) AS (
+			SELECT CASE WHEN SUBSTR(ID, 1, LENGTH(?1)) = ?1 THEN SUBSTR(ID, LENGTH(?1) + 1) ELSE ID END, SIZE FROM RESOURCES
+		)
+		SELECT CASE WHEN INSTR(REST, ?1) > 0 THEN SUBSTR(REST, 1, INSTR(REST, ?1) - 1) ELSE REST END AS TENANT, SUM(SIZE)
+		FROM PATHS GROUP BY TENANT;`, delimiter)
+	if err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	defer rows.Close()
+	res := map[string]int64{}
+	for rows.Next() {
+		var tenant string
+		var size int64
+		if err := rows.Scan(&tenant, &size); err != nil {
+			return nil, a.translate(ctx, err)
+		}
+		res[tenant] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	return res, nil
+}
+
+// AttributeKeys returns the sorted set of attribute keys used by any resource.
+func (a *Archive) AttributeKeys() ([]string, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	rows, err := a.reader().QueryContext(ctx, `SELECT ATTRIBUTES FROM RESOURCES;`)
+	if err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	defer rows.Close()
+	seen := map[string]bool{}
+	for rows.Next() {
+		var attributes string
+		if err := rows.Scan(&attributes); err != nil {
+			return nil, a.translate(ctx, err)
+		}
+		as, err := ParseAttributes(attributes)
+		if err != nil {
+			return nil, err
+		}
+		for k := range as {
+			seen[k] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	keys := []string{}
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
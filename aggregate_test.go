@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAggregateByAttribute(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "hello"))
+	a.Store(TextPlain("/b", "hi"))
+	a.Store(JPEG("/c", make([]byte, 100)))
+	a.Store(MakeResource("/d", Attributes{}, []byte("raw")))
+
+	got, err := a.AggregateByAttribute(AttributeType)
+	if err != nil {
+		t.Fatalf("expected aggregation to succeed: %s", err)
+	}
+	want := map[string]Aggregate{
+		TypeTextPlain: {Count: 2, TotalBytes: 7},
+		TypeImageJPEG: {Count: 1, TotalBytes: 100},
+		"":            {Count: 1, TotalBytes: 3},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d groups but got %v", len(want), got)
+	}
+	for k, w := range want {
+		if got[k] != w {
+			t.Fatalf("expected %v for %q but got %v", w, k, got[k])
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "hello"))
+	a.Store(TextPlain("/b", "hi"))
+	a.Store(JPEG("/c", make([]byte, 100)))
+	a.Store(MakeResource("/d", Attributes{}, []byte("raw")))
+
+	s, err := a.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Count != 4 || s.TotalBytes != 110 {
+		t.Fatalf("expected 4 resources of 110 bytes but got %d of %d", s.Count, s.TotalBytes)
+	}
+	if s.DiskBytes <= 0 {
+		t.Fatalf("expected a positive disk size but got %d", s.DiskBytes)
+	}
+	want := map[string]Aggregate{
+		TypeTextPlain: {Count: 2, TotalBytes: 7},
+		TypeImageJPEG: {Count: 1, TotalBytes: 100},
+		"":            {Count: 1, TotalBytes: 3},
+	}
+	if !reflect.DeepEqual(want, s.ByType) {
+		t.Fatalf("expected %v but got %v", want, s.ByType)
+	}
+}
+
+func TestAttributeKeys(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(MakeResource("/a", Attributes{AttributeType: TypeTextPlain, "Author": "me"}, nil))
+	a.Store(MakeResource("/b", Attributes{AttributeLabel: "b", "Author": "you"}, nil))
+
+	keys, err := a.AttributeKeys()
+	if err != nil {
+		t.Fatalf("expected keys to be listed: %s", err)
+	}
+	want := []string{"Author", AttributeChecksum, AttributeETag, AttributeLabel, AttributeLastModified, AttributeLength, AttributeType}
+	if !reflect.DeepEqual(want, keys) {
+		t.Fatalf("expected %v but got %v", want, keys)
+	}
+}
+
+func TestTenantUsage(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/t1/a", "hello"))
+	a.Store(TextPlain("/t1/b/c", "world!"))
+	a.Store(TextPlain("/t2/a", "abc"))
+	a.Store(TextPlain("/t3", "xy"))
+	a.Store(MakeResource("/t2/empty", Attributes{}, nil))
+
+	got, err := a.TenantUsage("/")
+	if err != nil {
+		t.Fatalf("expected usage to succeed: %s", err)
+	}
+	want := map[string]int64{"t1": 11, "t2": 3, "t3": 2}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+	if _, err := a.TenantUsage(""); err == nil {
+		t.Fatalf("expected an empty delimiter to be rejected")
+	}
+}
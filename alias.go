@@ -0,0 +1,47 @@
+package archive
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Link stores aliasID as an alias of targetID, that is a redirect resource
+// whose Location is targetID, see Redirect.
+func (a *Archive) Link(aliasID, targetID string) error {
+	return a.Store(Redirect(aliasID, targetID, http.StatusFound))
+}
+
+// AliasesOf returns the sorted IDs of every redirect resource that resolves
+// to targetID, directly or through other redirect resources.
+func (a *Archive) AliasesOf(targetID string) ([]string, error) {
+	ds, err := a.listMatching(func(as Attributes) bool {
+		return as.MediaType() == TypeRedirect
+	})
+	if err != nil {
+		return nil, err
+	}
+	locations := make(map[string]string, len(ds))
+	for _, d := range ds {
+		locations[d.ID] = d.Attributes[AttributeLocation]
+	}
+	aliases := []string{}
+	for id := range locations {
+		// follow the chain of redirects, stopping at cycles
+		seen := map[string]bool{id: true}
+		loc := locations[id]
+		for !seen[loc] {
+			if loc == targetID {
+				aliases = append(aliases, id)
+				break
+			}
+			seen[loc] = true
+			next, ok := locations[loc]
+			if !ok {
+				break
+			}
+			loc = next
+		}
+	}
+	sort.Strings(aliases)
+	return aliases, nil
+}
@@ -0,0 +1,37 @@
+package archive
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAliasesOf(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/target", "content"))
+	a.Store(TextPlain("/other", "content"))
+	if err := a.Link("/b", "/target"); err != nil {
+		t.Fatalf("expected link to succeed: %s", err)
+	}
+	a.Link("/a", "/target")
+	a.Link("/chained", "/a")
+	a.Link("/elsewhere", "/other")
+	a.Store(Redirect("/loop1", "/loop2", http.StatusMovedPermanently))
+	a.Store(Redirect("/loop2", "/loop1", http.StatusMovedPermanently))
+
+	got, err := a.AliasesOf("/target")
+	if err != nil {
+		t.Fatalf("expected lookup to succeed: %s", err)
+	}
+	if want := []string{"/a", "/b", "/chained"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+	if got, _ := a.AliasesOf("/missing"); len(got) != 0 {
+		t.Fatalf("expected no aliases but got %v", got)
+	}
+}
@@ -0,0 +1,24 @@
+package archive
+
+import "strings"
+
+// allowed reports whether a resource with attributes as may be stored under
+// the types configured with WithAllowedTypes.
+func (a *Archive) allowed(as Attributes) bool {
+	if a.allowedTypes == nil {
+		return true
+	}
+	typ := as.MediaType()
+	if typ == "" {
+		return false
+	}
+	for _, t := range a.allowedTypes {
+		switch {
+		case t == "*/*", t == typ:
+			return true
+		case strings.HasSuffix(t, "/*") && strings.HasPrefix(typ, t[:len(t)-1]):
+			return true
+		}
+	}
+	return false
+}
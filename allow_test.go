@@ -0,0 +1,35 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestWithAllowedTypes(t *testing.T) {
+	a, err := Open(":memory:", WithAllowedTypes("image/*", TypeApplicationPDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	tests := []struct {
+		name string
+		res  Resource
+		err  error
+	}{
+		{name: "wildcard", res: JPEG("/jpeg", []byte("jpeg"))},
+		{name: "exact", res: MakeResource("/pdf", Attributes{AttributeType: TypeApplicationPDF}, nil)},
+		{name: "disallowed", res: TextPlain("/text", "text"), err: ErrUnsupportedType},
+		{name: "untyped", res: MakeResource("/raw", Attributes{}, nil), err: ErrUnsupportedType},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := a.Store(test.res); !errors.Is(err, test.err) {
+				t.Fatalf("expected %v but got %v", test.err, err)
+			}
+			if _, err := a.Attributes(test.res.ID); (err == nil) != (test.err == nil) {
+				t.Fatalf("expected resource to be stored only if allowed: %v", err)
+			}
+		})
+	}
+}
@@ -1,209 +1,1714 @@
 package archive
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime"
+	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/cognicraft/sqlutil"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func Open(dsn string) (*Archive, error) {
+// Open opens the archive stored at dsn. Opening a file that is already open
+// in this process returns the same, shared *Archive, which is closed once
+// every Open has been matched by a Close; the options of later calls are
+// ignored in that case.
+func Open(dsn string, opts ...Option) (*Archive, error) {
 	a := &Archive{
-		dsn: dsn,
+		dsn:     dsn,
+		driver:  DefaultDriver,
+		clock:   time.Now,
+		sniffer: TypeSnifferFunc(DetectType),
+		opts:    opts,
 	}
-	return a, a.init()
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.readOnly {
+		a.dsn = readOnlyDSN(dsn)
+	}
+	key := registryKey(a.driver, a.dsn)
+	if key == "" {
+		return a, a.init()
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if shared, ok := registry.open[key]; ok {
+		shared.refs++
+		return shared, nil
+	}
+	if err := a.init(); err != nil {
+		return a, err
+	}
+	a.key, a.refs = key, 1
+	registry.open[key] = a
+	return a, nil
+}
+
+var registry = struct {
+	sync.Mutex
+	open map[string]*Archive
+}{open: map[string]*Archive{}}
+
+// registryKey identifies the database file behind dsn, or returns "" for
+// in-memory databases, which are never shared.
+func registryKey(driver, dsn string) string {
+	if isMemory(dsn) {
+		return ""
+	}
+	path, query := dsn, ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		path, query = dsn[:i], dsn[i:]
+	}
+	path, err := filepath.Abs(strings.TrimPrefix(path, "file:"))
+	if err != nil {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return driver + ":" + path + query
 }
 
 type Archive struct {
-	dsn string
+	opts          []Option
+	dsn           string
+	driver        string
+	timeout       time.Duration
+	clock         func() time.Time
+	versioning    bool
+	deltaVersions bool
+	readOnly      bool
+
+	compress    bool
+	compression int
+	encoding    string
 
-	mu sync.Mutex
-	db *sql.DB
+	sniffer            TypeSniffer
+	octetStreamDefault bool
+	allowedTypes       []string
+	maxAttributesSize  int
+	imageMetadata      bool
+
+	pageSize         int
+	cacheSize        int
+	singleConnection bool
+	readers          int
+
+	creationTime     bool
+	vacuumOnShutdown bool
+
+	inlineThreshold int64
+	blobs           string
+
+	encryptionKey []byte
+	aead          cipher.AEAD
+
+	coldMu sync.Mutex
+	cold   *Archive
+
+	actor  string
+	access *accessCounter
+	mirror *mirror
+	queue  *writeQueue
+
+	key    string
+	refs   int
+	closed int32
+
+	mu  sync.Mutex
+	db  *sql.DB
+	rdb *sql.DB
+
+	derivationsMu sync.Mutex
+	derivations   map[string]derivation
+
+	watchMu  sync.Mutex
+	watchers map[chan Event]bool
 }
 
 func (a *Archive) Revision() int {
-	row := a.db.QueryRow(`SELECT VALUE FROM INFO WHERE NAME = ?;`, InfoRevision)
+	ctx, cancel := a.context()
+	defer cancel()
+	row := a.reader().QueryRowContext(ctx, `SELECT VALUE FROM INFO WHERE NAME = ?;`, InfoRevision)
 	revision := 0
 	row.Scan(&revision)
 	return revision
 }
 
+// DB returns the database handle of the archive for advanced queries, such
+// as reports joining its tables. The handle bypasses the locking, caching and
+// invariants of the archive, so modifying the database through it is unsafe
+// and at the caller's risk. The handle must not be closed.
+func (a *Archive) DB() *sql.DB {
+	return a.db
+}
+
 func (a *Archive) List() ([]Descriptor, error) {
-	rows, err := a.db.Query(`SELECT ID, ATTRIBUTES FROM RESOURCES ORDER BY ID;`)
+	return a.ListContext(context.Background())
+}
+
+// ListContext is like List but stops when ctx is done.
+func (a *Archive) ListContext(ctx context.Context) ([]Descriptor, error) {
+	return a.queryDescriptorsContext(ctx, `SELECT ID, ATTRIBUTES FROM RESOURCES ORDER BY ID;`)
+}
+
+func (a *Archive) ListWithPrefix(prefix string) ([]Descriptor, error) {
+	return a.ListWithPrefixContext(context.Background(), prefix)
+}
+
+// ListWithPrefixContext is like ListWithPrefix but stops when ctx is done.
+func (a *Archive) ListWithPrefixContext(ctx context.Context, prefix string) ([]Descriptor, error) {
+	return a.queryDescriptorsContext(ctx, `SELECT ID, ATTRIBUTES FROM RESOURCES WHERE ID LIKE ? ESCAPE '\' ORDER BY ID;`, likePrefix(prefix))
+}
+
+// Count returns the number of resources.
+func (a *Archive) Count() (int, error) {
+	return a.count(`SELECT COUNT(*) FROM RESOURCES;`)
+}
+
+// CountWithPrefix returns the number of resources whose ID starts with
+// prefix.
+func (a *Archive) CountWithPrefix(prefix string) (int, error) {
+	return a.count(`SELECT COUNT(*) FROM RESOURCES WHERE ID LIKE ? ESCAPE '\';`, likePrefix(prefix))
+}
+
+// Exists reports whether a resource exists without loading it.
+func (a *Archive) Exists(id string) (bool, error) {
+	n, err := a.count(`SELECT COUNT(*) FROM RESOURCES WHERE ID = ?;`, id)
+	return n > 0, err
+}
+
+func (a *Archive) count(query string, args ...interface{}) (int, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	var n int
+	if err := a.reader().QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+		return 0, a.translate(ctx, err)
+	}
+	return n, nil
+}
+
+// ListBySize lists the resources whose data length lies within [min, max],
+// largest first. A negative max leaves the range open-ended.
+func (a *Archive) ListBySize(min, max int64) ([]Descriptor, error) {
+	if max < 0 {
+		return a.queryDescriptors(`SELECT ID, ATTRIBUTES FROM RESOURCES WHERE SIZE >= ? ORDER BY SIZE DESC, ID;`, min)
+	}
+	return a.queryDescriptors(`SELECT ID, ATTRIBUTES FROM RESOURCES WHERE SIZE BETWEEN ? AND ? ORDER BY SIZE DESC, ID;`, min, max)
+}
+
+// ListByAttribute lists the resources whose attribute key has the given
+// value.
+func (a *Archive) ListByAttribute(key, value string) ([]Descriptor, error) {
+	return a.listMatching(func(as Attributes) bool {
+		v, ok := as[key]
+		return ok && v == value
+	})
+}
+
+// ListMissingAttribute lists the resources that lack the attribute key.
+func (a *Archive) ListMissingAttribute(key string) ([]Descriptor, error) {
+	return a.listMatching(func(as Attributes) bool {
+		return !as.Has(key)
+	})
+}
+
+func (a *Archive) listMatching(match func(Attributes) bool) ([]Descriptor, error) {
+	ds, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+	res := []Descriptor{}
+	for _, d := range ds {
+		if match(d.Attributes) {
+			res = append(res, d)
+		}
+	}
+	return res, nil
+}
+
+// Recent lists the n most recently modified resources, newest first.
+func (a *Archive) Recent(n int) ([]Descriptor, error) {
+	return a.queryDescriptors(`SELECT ID, ATTRIBUTES FROM RESOURCES ORDER BY MODIFIED DESC, ID LIMIT ?;`, n)
+}
+
+func (a *Archive) queryDescriptors(query string, args ...interface{}) ([]Descriptor, error) {
+	return a.queryDescriptorsContext(context.Background(), query, args...)
+}
+
+func (a *Archive) queryDescriptorsContext(parent context.Context, query string, args ...interface{}) ([]Descriptor, error) {
+	ctx, cancel := a.contextFrom(parent)
+	defer cancel()
+	rows, err := a.reader().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	defer rows.Close()
+	res := []Descriptor{}
+	for rows.Next() {
+		var id string
+		var attributes string
+		err = rows.Scan(&id, &attributes)
+		if err != nil {
+			return nil, a.translate(ctx, err)
+		}
+		as, err := ParseAttributes(attributes)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, Descriptor{ID: id, Attributes: as})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	return res, nil
+}
+
+// Describe returns the descriptor of a single resource, or ErrNotFound.
+func (a *Archive) Describe(id string) (Descriptor, error) {
+	ds, err := a.queryDescriptors(`SELECT ID, ATTRIBUTES FROM RESOURCES WHERE ID = ?;`, id)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if len(ds) == 0 {
+		return Descriptor{}, ErrNotFound
+	}
+	return ds[0], nil
+}
+
+func (a *Archive) Attributes(id string) (Attributes, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	row := a.reader().QueryRowContext(ctx, `SELECT ATTRIBUTES FROM RESOURCES WHERE ID = ?;`, id)
+	var attributes string
+	err := row.Scan(&attributes)
+	if err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	as, err := ParseAttributes(attributes)
+	if err != nil {
+		return nil, err
+	}
+	return as, nil
+}
+
+func (a *Archive) Load(id string) (Resource, error) {
+	return a.LoadContext(context.Background(), id)
+}
+
+// LoadContext is like Load but stops when ctx is done.
+func (a *Archive) LoadContext(ctx context.Context, id string) (Resource, error) {
+	var res Resource
+	var err error
+	if d, ok := a.derivation(id); ok {
+		if err := ctx.Err(); err != nil {
+			return Resource{}, err
+		}
+		res, err = a.loadDerived(id, d)
+	} else {
+		res, err = a.loadContext(ctx, id)
+	}
+	if err == nil && a.access != nil {
+		err = a.countAccess(id)
+	}
+	return res, err
+}
+
+func (a *Archive) load(id string) (Resource, error) {
+	return a.loadContext(context.Background(), id)
+}
+
+func (a *Archive) loadContext(parent context.Context, id string) (Resource, error) {
+	res, err := a.loadStoredContext(parent, id)
+	if err != nil {
+		return Resource{}, err
+	}
+	if res.Data, err = decode(res.Attributes, res.Data); err != nil {
+		return Resource{}, err
+	}
+	return res, nil
+}
+
+// loadStored loads a resource with its data as stored, i.e. encoded as its
+// Encoding attribute says.
+func (a *Archive) loadStored(id string) (Resource, error) {
+	return a.loadStoredContext(context.Background(), id)
+}
+
+func (a *Archive) loadStoredContext(parent context.Context, id string) (Resource, error) {
+	ctx, cancel := a.contextFrom(parent)
+	defer cancel()
+	row := a.reader().QueryRowContext(ctx, `SELECT ATTRIBUTES, DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, id)
+	var attributes string
+	var data []byte
+	var external sql.NullString
+	err := row.Scan(&attributes, &data, &external)
+	if err != nil {
+		return Resource{}, a.translate(ctx, err)
+	}
+	if data, err = a.fetch(data, external); err != nil {
+		return Resource{}, err
+	}
+	as, err := ParseAttributes(attributes)
+	if err != nil {
+		return Resource{}, err
+	}
+	res := Resource{
+		ID:         id,
+		Data:       data,
+		Attributes: as,
+	}
+	return res, nil
+}
+
+// RawRow is a low-level diagnostic returning the attributes text of a
+// resource and the length of its data exactly as stored, along with the
+// Encoding found in that text. Nothing is parsed or decoded, so this shows
+// what is on disk when the parsed view looks wrong.
+func (a *Archive) RawRow(id string) (attributesText string, dataLen int64, storedEncoding string, err error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	row := a.db.QueryRowContext(ctx, `SELECT ATTRIBUTES, LENGTH(CAST(DATA AS BLOB)), EXTERNAL FROM RESOURCES WHERE ID = ?;`, id)
+	var n sql.NullInt64
+	var external sql.NullString
+	if err := row.Scan(&attributesText, &n, &external); err != nil {
+		return "", 0, "", a.translate(ctx, err)
+	}
+	if _, ok := tiered(external); external.Valid && !ok {
+		if n.Int64, err = a.externalSize(external); err != nil {
+			return "", 0, "", err
+		}
+	}
+	for _, line := range strings.Split(attributesText, "\n") {
+		if v := strings.TrimPrefix(line, AttributeEncoding+": "); v != line {
+			storedEncoding = strings.TrimSuffix(v, "\r")
+		}
+	}
+	return attributesText, n.Int64, storedEncoding, nil
+}
+
+// Reader returns a reader for the data of a resource together with its
+// attributes. The reader must be closed by the caller.
+func (a *Archive) Reader(id string) (io.ReadCloser, Attributes, error) {
+	r, err := a.Load(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(r.Data)), r.Attributes, nil
+}
+
+// LoadThrough is like Reader but passes the data through transform. Closing
+// the returned reader closes the underlying one.
+func (a *Archive) LoadThrough(id string, transform func(io.Reader) io.Reader) (io.ReadCloser, Attributes, error) {
+	rc, as, err := a.Reader(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{transform(rc), rc}, as, nil
+}
+
+// ContentHash returns the hash algorithm and hex encoded digest of the data
+// of a resource. The stored checksum is used when present, otherwise the
+// digest is computed without handing the data to the caller.
+func (a *Archive) ContentHash(id string) (algo, digest string, err error) {
+	as, err := a.Attributes(id)
+	if err != nil {
+		return "", "", err
+	}
+	sum := as[AttributeChecksum]
+	if sum == "" {
+		ctx, cancel := a.context()
+		defer cancel()
+		var data []byte
+		var external sql.NullString
+		if err := a.reader().QueryRowContext(ctx, `SELECT DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&data, &external); err != nil {
+			return "", "", a.translate(ctx, err)
+		}
+		if data, err = a.fetch(data, external); err != nil {
+			return "", "", err
+		}
+		if data, err = decode(as, data); err != nil {
+			return "", "", err
+		}
+		sum = Checksum(data)
+	}
+	algo, digest = splitChecksum(sum)
+	return algo, digest, nil
+}
+
+// Store stores a resource. With WithAsyncWrites it only queues the resource,
+// see Flush.
+func (a *Archive) Store(r Resource) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	if a.queue != nil {
+		return a.queue.enqueue(r)
+	}
+	return a.store(r.ID, r.Attributes, r.Data, Checksum(r.Data))
+}
+
+// StoreReader stores the data read from r, computing its length and checksum
+// in the same pass. Unless as specifies a Type, it is sniffed from the data.
+func (a *Archive) StoreReader(id string, as Attributes, r io.Reader) error {
+	if !as.Has(AttributeType) {
+		br := bufio.NewReaderSize(r, sniffLen)
+		head, _ := br.Peek(sniffLen)
+		if typ := a.detectType("", head); typ != "" {
+			as = as.Clone()
+			as[AttributeType] = withDefaultCharset(typ)
+		}
+		r = br
+	}
+	return a.StoreTee(id, as, r, ioutil.Discard)
+}
+
+// StoreTee stores the data read from r while copying it to tee in the same
+// pass. Nothing is stored if either reading r or writing tee fails. See
+// StoreStream for when the data is buffered.
+func (a *Archive) StoreTee(id string, as Attributes, r io.Reader, tee io.Writer) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	if a.spools() {
+		return a.storeSpooled(id, as, r, tee)
+	}
+	buf := &bytes.Buffer{}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(buf, h, tee), r); err != nil {
+		return err
+	}
+	return a.store(id, as, buf.Bytes(), checksumPrefix+hex.EncodeToString(h.Sum(nil)))
+}
+
+func (a *Archive) store(id string, attributes Attributes, data []byte, sum string) error {
+	return a.storeContext(context.Background(), id, attributes, data, sum)
+}
+
+// StoreContext is like Store but stops when ctx is done, rolling back, and
+// takes the actor recorded in the Last-Modified-By attribute from ctx, see
+// ContextWithActor.
+func (a *Archive) StoreContext(ctx context.Context, r Resource) error {
+	return a.storeContext(ctx, r.ID, r.Attributes, r.Data, Checksum(r.Data))
+}
+
+func (a *Archive) storeContext(parent context.Context, id string, attributes Attributes, data []byte, sum string) error {
+	return a.write(parent, func(ctx context.Context, tx *sql.Tx) error {
+		if err := a.put(ctx, tx, id, attributes, data, sum); err != nil {
+			return err
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
+
+// Delete deletes a resource. It fails with ErrInUse if the resource is held,
+// see Retain.
+func (a *Archive) Delete(id string) error {
+	return a.delete(context.Background(), id, false)
+}
+
+// DeleteContext is like Delete but stops when ctx is done, in which case
+// nothing is deleted.
+func (a *Archive) DeleteContext(ctx context.Context, id string) error {
+	return a.delete(ctx, id, false)
+}
+
+// ForceDelete deletes a resource regardless of its holds.
+func (a *Archive) ForceDelete(id string) error {
+	return a.delete(context.Background(), id, true)
+}
+
+func (a *Archive) delete(parent context.Context, id string, force bool) error {
+	return a.write(parent, func(ctx context.Context, tx *sql.Tx) error {
+		if !force {
+			if err := checkHolds(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		ok, err := a.remove(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return bumpRevision(ctx, tx)
+		}
+		return nil
+	})
+}
+
+// DeleteByAttribute deletes every resource whose attribute key has the given
+// value in a single transaction and returns their number. Like Delete, it
+// fails with ErrInUse if any of them is held.
+func (a *Archive) DeleteByAttribute(key, value string) (int, error) {
+	n := 0
+	err := a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		ids, err := matching(ctx, tx, func(as Attributes) bool {
+			v, ok := as[key]
+			return ok && v == value
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := checkHolds(ctx, tx, id); err != nil {
+				return err
+			}
+			if _, err := a.remove(ctx, tx, id); err != nil {
+				return err
+			}
+			n++
+		}
+		if n == 0 {
+			return nil
+		}
+		return bumpRevision(ctx, tx)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// DeleteWithPrefix deletes all resources whose IDs start with prefix, taken
+// literally, in a single statement and returns how many were deleted. It
+// fails with ErrInUse, deleting nothing, if any of them is held.
+func (a *Archive) DeleteWithPrefix(prefix string) (int, error) {
+	// LIKE ignores case, so the prefix is compared exactly as well
+	pattern := likePrefix(prefix)
+	n := 0
+	err := a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT ID FROM RESOURCES WHERE ID LIKE ? ESCAPE '\' AND SUBSTR(ID, 1, LENGTH(?)) = ? ORDER BY ID;`, pattern, prefix, prefix)
+		if err != nil {
+			return err
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := checkHolds(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		r, err := tx.ExecContext(ctx, `DELETE FROM RESOURCES WHERE ID LIKE ? ESCAPE '\' AND SUBSTR(ID, 1, LENGTH(?)) = ?;`, pattern, prefix, prefix)
+		if err != nil {
+			return err
+		}
+		affected, _ := r.RowsAffected()
+		n = int(affected)
+		for _, id := range ids {
+			if err := a.removed(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		if n > 0 {
+			return bumpRevision(ctx, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ReplaceSubtree atomically replaces every resource whose ID starts with
+// prefix by rs, bumping the revision once. Each of rs must lie below prefix.
+// Like Delete, it fails with ErrInUse if a resource that is not replaced is
+// held.
+func (a *Archive) ReplaceSubtree(prefix string, rs []Resource) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(rs))
+	for _, r := range rs {
+		if !strings.HasPrefix(r.ID, prefix) {
+			return fmt.Errorf("archive: %s is not below %s", r.ID, prefix)
+		}
+		keep[r.ID] = true
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		ids, err := withPrefix(ctx, tx, prefix)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if keep[id] {
+				continue
+			}
+			if err := checkHolds(ctx, tx, id); err != nil {
+				return err
+			}
+			if _, err := a.remove(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+		for _, r := range rs {
+			if err := a.put(ctx, tx, r.ID, r.Attributes, r.Data, Checksum(r.Data)); err != nil {
+				return err
+			}
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
+
+// likePrefix returns a LIKE pattern for use with ESCAPE '\' matching the
+// IDs that start with prefix.
+func likePrefix(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// withPrefix returns the IDs of the resources below prefix.
+func withPrefix(ctx context.Context, tx *sql.Tx, prefix string) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT ID FROM RESOURCES WHERE ID LIKE ? ESCAPE '\' ORDER BY ID;`, likePrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// matching returns the IDs of the resources whose attributes satisfy match.
+func matching(ctx context.Context, tx *sql.Tx, match func(Attributes) bool) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT ID, ATTRIBUTES FROM RESOURCES ORDER BY ID;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []string
+	for rows.Next() {
+		var id, attributes string
+		if err := rows.Scan(&id, &attributes); err != nil {
+			return nil, err
+		}
+		if as, _ := ParseAttributes(attributes); match(as) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// StoreBatch stores rs in a single transaction, bumping the revision once.
+// If any of them cannot be stored, none are.
+func (a *Archive) StoreBatch(rs []Resource) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	if len(rs) == 0 {
+		return nil
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		for _, r := range rs {
+			if err := a.put(ctx, tx, r.ID, r.Attributes, r.Data, Checksum(r.Data)); err != nil {
+				return err
+			}
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
+
+// Batch runs fn within a single transaction. All changes made through the
+// batch are committed together and bump the revision only once. If fn returns
+// an error, none of them are applied.
+func (a *Archive) Batch(fn func(b *Batch) error) error {
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		b := &Batch{a: a, ctx: ctx, tx: tx}
+		if err := fn(b); err != nil {
+			return err
+		}
+		if !b.changed {
+			return nil
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
+
+type Batch struct {
+	a       *Archive
+	ctx     context.Context
+	tx      *sql.Tx
+	changed bool
+}
+
+func (b *Batch) Store(r Resource) error {
+	if err := b.a.put(b.ctx, b.tx, r.ID, r.Attributes, r.Data, Checksum(r.Data)); err != nil {
+		return err
+	}
+	b.changed = true
+	return nil
+}
+
+func (b *Batch) Delete(id string) error {
+	if err := checkHolds(b.ctx, b.tx, id); err != nil {
+		return err
+	}
+	ok, err := b.a.remove(b.ctx, b.tx, id)
+	if err != nil {
+		return err
+	}
+	if ok {
+		b.changed = true
+	}
+	return nil
+}
+
+func (a *Archive) ImportFile(id string, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	as := Attributes{AttributeFilename: filepath.Base(file)}
+	r := bufio.NewReaderSize(f, sniffLen)
+	head, _ := r.Peek(sniffLen)
+	if typ := a.detectType(filepath.Ext(file), head); typ != "" {
+		as[AttributeType] = withDefaultCharset(typ)
+	}
+	return a.StoreTee(id, as, r, ioutil.Discard)
+}
+
+// ImportFileIfChanged is like ImportFile but leaves the archive untouched if
+// the stored data has the same checksum as the file. It reports whether the
+// resource was stored.
+func (a *Archive) ImportFileIfChanged(id string, file string) (bool, error) {
+	if err := a.writable(); err != nil {
+		return false, err
+	}
+	r, err := a.readFile(id, file)
+	if err != nil {
+		return false, err
+	}
+	sum := Checksum(r.Data)
+
+	changed := false
+	err = a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		var attributes string
+		err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if as, _ := ParseAttributes(attributes); err == nil && as[AttributeChecksum] == sum {
+			return nil
+		}
+		if err := a.put(ctx, tx, id, r.Attributes, r.Data, sum); err != nil {
+			return err
+		}
+		changed = true
+		return bumpRevision(ctx, tx)
+	})
+	if err != nil {
+		return false, err
+	}
+	return changed, nil
+}
+
+func (a *Archive) readFile(id string, file string) (Resource, error) {
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return Resource{}, err
+	}
+	attr := Attributes{AttributeFilename: filepath.Base(file)}
+	if typ := a.detectType(filepath.Ext(file), bs); typ != "" {
+		attr[AttributeType] = withDefaultCharset(typ)
+	}
+	return MakeResource(id, attr, bs), nil
+}
+
+// ImportReader stores the data read from r with the given content type, or a
+// sniffed one if contentType is empty.
+func (a *Archive) ImportReader(id, contentType string, r io.Reader) error {
+	as := Attributes{}
+	if contentType != "" {
+		as[AttributeType] = withDefaultCharset(contentType)
+	}
+	return a.StoreReader(id, as, r)
+}
+
+func (a *Archive) ExportFile(id string, file string) error {
+	r, _, err := a.LoadStream(id)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (a *Archive) ExportAttributes(w io.Writer) error {
+	ds, err := a.List()
+	if err != nil {
+		return err
+	}
+	m := make(map[string]Attributes, len(ds))
+	for _, d := range ds {
+		m[d.ID] = d.Attributes
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+func (a *Archive) ApplyAttributes(r io.Reader) (int, error) {
+	if err := a.writable(); err != nil {
+		return 0, err
+	}
+	m := map[string]Attributes{}
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	err := a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		for id, as := range m {
+			ok, err := a.updateAttributes(ctx, tx, id, func(cur Attributes) {
+				for k, v := range as {
+					// the ETag belongs to the data, which is left alone
+					if !IsManagedAttribute(k) && k != AttributeETag {
+						cur[k] = v
+					}
+				}
+			})
+			if err != nil {
+				return err
+			}
+			if ok {
+				n++
+			}
+		}
+		if n > 0 {
+			return bumpRevision(ctx, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (a *Archive) Close() error {
+	if a.isClosed() {
+		return nil
+	}
+	if a.key != "" {
+		registry.Lock()
+		a.refs--
+		if a.refs > 0 {
+			registry.Unlock()
+			return nil
+		}
+		delete(registry.open, a.key)
+		registry.Unlock()
+	}
+	var err error
+	if a.queue != nil {
+		err = a.queue.stop()
+	}
+	if ferr := a.FlushAccessCounts(); err == nil {
+		err = ferr
+	}
+	a.unwatchAll()
+	atomic.StoreInt32(&a.closed, 1)
+	if cerr := a.closeReaders(); err == nil {
+		err = cerr
+	}
+	if cerr := a.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// CloneToMemory copies the archive into a new in-memory archive opened with
+// the same options, which can then be changed independently. The clone is
+// writable and leaves out WithMirror, WithColdTier and WithAsyncWrites, so
+// that its writes reach no other archive and are committed right away; the
+// data of tiered resources cannot be loaded from it.
+func (a *Archive) CloneToMemory() (*Archive, error) {
+	opts := append(append([]Option{}, a.opts...), isolated)
+	c, err := Open(":memory:", opts...)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := a.context()
+	defer cancel()
+	if err := backup(ctx, c.db, a.db); err != nil {
+		c.Close()
+		return nil, a.translate(ctx, err)
+	}
+	// external data is read from the files of a, while the clone keeps the
+	// data of its own writes inline
+	c.blobs, c.inlineThreshold = a.blobs, 0
+	return c, nil
+}
+
+// isolated undoes the options that CloneToMemory leaves out.
+func isolated(a *Archive) {
+	a.mirror, a.cold, a.queue, a.readOnly = nil, nil, nil, false
+}
+
+// Backup copies the archive to a new database file at dstPath, replacing any
+// file there, using SQLite's online backup API, together with the external
+// data files it refers to. The result can be opened with Open. The copy is a
+// snapshot of the archive as of one point during the backup: Store calls
+// that commit while it is taken are either entirely in the copy or not at
+// all. Writes are not stopped, but in the default rollback journal mode they
+// wait for the snapshot to be read, as they do for any reader; in WAL mode,
+// see WithReaders, they proceed alongside it.
+func (a *Archive) Backup(dstPath string) error {
+	ctx, cancel := a.context()
+	defer cancel()
+	dst, err := sql.Open(a.driver, dstPath)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if err := backup(ctx, dst, a.db); err != nil {
+		return a.translate(ctx, err)
+	}
+	if a.blobs == "" {
+		return nil
+	}
+	rows, err := dst.QueryContext(ctx, `SELECT DISTINCT EXTERNAL FROM RESOURCES WHERE EXTERNAL IS NOT NULL AND EXTERNAL NOT LIKE ?;`, tierPrefix+"%")
+	if err != nil {
+		return a.translate(ctx, err)
+	}
+	defer rows.Close()
+	dir := blobDir(dstPath)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return a.translate(ctx, err)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := copyFile(filepath.Join(dir, name), filepath.Join(a.blobs, name)); err != nil {
+			return err
+		}
+	}
+	return a.translate(ctx, rows.Err())
+}
+
+func copyFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Shutdown waits for in-flight writes, checkpoints the write-ahead log,
+// vacuums the database if WithVacuumOnShutdown is set and closes the archive
+// within the deadline of ctx, however often it has been opened. Subsequent
+// operations fail with ErrClosed. Calling Shutdown again has no effect.
+func (a *Archive) Shutdown(ctx context.Context) error {
+	if a.isClosed() {
+		return nil
+	}
+	var qerr error
+	if a.queue != nil {
+		qerr = a.queue.stop()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.isClosed() {
+		return nil
+	}
+	if a.key != "" {
+		registry.Lock()
+		if registry.open[a.key] == a {
+			delete(registry.open, a.key)
+		}
+		registry.Unlock()
+	}
+	var err error
+	if a.access != nil {
+		err = a.flushAccessCounts(ctx)
+	}
+	if err == nil && !a.readOnly {
+		_, err = a.db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE);`)
+	}
+	if err == nil && a.vacuumOnShutdown && !a.readOnly {
+		_, err = a.db.ExecContext(ctx, `VACUUM;`)
+	}
+	err = a.translate(ctx, err)
+	a.unwatchAll()
+	atomic.StoreInt32(&a.closed, 1)
+	if cerr := a.closeReaders(); err == nil {
+		err = cerr
+	}
+	if cerr := a.db.Close(); err == nil {
+		err = cerr
+	}
+	if qerr != nil {
+		return qerr
+	}
+	return err
+}
+
+func (a *Archive) isClosed() bool {
+	return atomic.LoadInt32(&a.closed) != 0
+}
+
+func (a *Archive) init() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := checkDriver(a.driver); err != nil {
+		return err
+	}
+	if a.encryptionKey != nil {
+		aead, err := newAEAD(a.encryptionKey)
+		if err != nil {
+			return err
+		}
+		a.aead = aead
+	}
+	if a.readOnly {
+		a.access = nil
+	}
+	db, err := sql.Open(a.driver, a.dsn)
+	if err != nil {
+		return err
+	}
+	if pragmas := a.pragmas(); len(pragmas) > 0 {
+		drv := db.Driver()
+		db.Close()
+		db = sql.OpenDB(pragmaConnector{driver: drv, dsn: a.dsn, pragmas: pragmas})
+	}
+
+	if isMemory(a.dsn) || a.singleConnection {
+		// every connection to an in-memory database opens a database of its own
+		// and WithSingleConnection asks for the same
+		db.SetMaxOpenConns(1)
+	}
+
+	ctx, cancel := a.context()
+	defer cancel()
+	if err := quickCheck(ctx, db); err != nil {
+		db.Close()
+		return a.translate(ctx, err)
+	}
+	a.blobs = blobDir(a.dsn)
+	if !a.readOnly || isMemory(a.dsn) {
+		if err := a.migrate(ctx, db); err != nil {
+			db.Close()
+			return a.translate(ctx, err)
+		}
+	}
+	if err := a.checkKey(ctx, db); err != nil {
+		db.Close()
+		return a.translate(ctx, err)
+	}
+	if err := a.openReaders(ctx, db); err != nil {
+		db.Close()
+		return a.translate(ctx, err)
+	}
+	a.db = db
+	if a.queue != nil {
+		go a.runQueue()
+	}
+	return nil
+}
+
+// migrate creates or updates the schema of db and moves data in or out of
+// blob files as the inline threshold asks for.
+func (a *Archive) migrate(ctx context.Context, db *sql.DB) error {
+	for _, stmt := range schema {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	for _, c := range columns {
+		if err := addColumn(ctx, db, c); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range indexes {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if err := a.relocate(ctx, db); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, `INSERT OR IGNORE INTO INFO (name, value) VALUES (?, ?);`, InfoRevision, "0")
+	return err
+}
+
+// quickCheck reports ErrCorrupt if the database fails SQLite's quick
+// integrity check, so that damage is noticed on open rather than mid-query.
+func quickCheck(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `PRAGMA quick_check;`)
+	if err != nil {
+		return corruption(err)
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return corruption(err)
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return corruption(err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s; restore the archive from a backup", ErrCorrupt, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// corruption wraps errors that indicate a damaged database file in ErrCorrupt.
+func corruption(err error) error {
+	msg := err.Error()
+	if strings.Contains(msg, "malformed") || strings.Contains(msg, "not a database") {
+		return fmt.Errorf("%w: %s; restore the archive from a backup", ErrCorrupt, msg)
+	}
+	return err
+}
+
+func (a *Archive) pragmas() []string {
+	var pragmas []string
+	if a.pageSize > 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA page_size = %d;", a.pageSize))
+	}
+	if a.cacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA cache_size = %d;", a.cacheSize))
+	}
+	if a.readOnly && !isMemory(a.dsn) {
+		pragmas = append(pragmas, `PRAGMA query_only = ON;`)
+	}
+	return pragmas
+}
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS INFO (NAME TEXT, VALUE TEXT, PRIMARY KEY (NAME));`,
+	`CREATE TABLE IF NOT EXISTS RESOURCES (ID TEXT, ATTRIBUTES TEXT, DATA BLOB, PRIMARY KEY (ID));`,
+	`CREATE TABLE IF NOT EXISTS EDGES (FROM_ID TEXT, TO_ID TEXT, REL TEXT, PRIMARY KEY (FROM_ID, REL, TO_ID));`,
+	`CREATE INDEX IF NOT EXISTS EDGES_TO_ID ON EDGES (TO_ID);`,
+	`CREATE TABLE IF NOT EXISTS QUOTAS (PREFIX TEXT, MAX_BYTES INTEGER, PRIMARY KEY (PREFIX));`,
+	`CREATE TABLE IF NOT EXISTS ACCESS (ID TEXT, COUNT INTEGER, PRIMARY KEY (ID));`,
+	`CREATE TABLE IF NOT EXISTS HOLDS (ID TEXT, COUNT INTEGER, PRIMARY KEY (ID));`,
+	`CREATE TABLE IF NOT EXISTS HISTORY (ID TEXT, REVISION INTEGER, ATTRIBUTES TEXT, DATA BLOB, PRIMARY KEY (ID, REVISION));`,
+	`CREATE TABLE IF NOT EXISTS CHANGES (REVISION INTEGER, ID TEXT, OP TEXT, PRIMARY KEY (REVISION, ID));`,
+}
+
+// columns have been added to the schema over time. They are added to
+// existing archives on open and filled from the data already present.
+var columns = []column{
+	{table: "RESOURCES", name: "SIZE", decl: "INTEGER", backfill: `UPDATE RESOURCES SET SIZE = IFNULL(LENGTH(DATA), 0);`},
+	{table: "RESOURCES", name: "MODIFIED", decl: "TEXT", fill: fillModified},
+	{table: "RESOURCES", name: "EXTERNAL", decl: "TEXT"},
+	{table: "HISTORY", name: "BASE", decl: "INTEGER"},
+}
+
+var indexes = []string{
+	`CREATE INDEX IF NOT EXISTS RESOURCES_SIZE ON RESOURCES (SIZE);`,
+	`CREATE INDEX IF NOT EXISTS RESOURCES_MODIFIED ON RESOURCES (MODIFIED);`,
+}
+
+// A column is filled either by the backfill statement or, where that cannot
+// be expressed in SQL, by fill.
+type column struct {
+	table    string
+	name     string
+	decl     string
+	backfill string
+	fill     func(context.Context, *sql.Tx) error
+}
+
+func addColumn(ctx context.Context, db *sql.DB, c column) error {
+	rows, err := db.QueryContext(ctx, `SELECT NAME FROM PRAGMA_TABLE_INFO(?);`, c.table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if strings.EqualFold(name, c.name) {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	return transact(ctx, db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `ALTER TABLE `+c.table+` ADD COLUMN `+c.name+` `+c.decl+`;`); err != nil {
+			return err
+		}
+		if c.fill != nil {
+			return c.fill(ctx, tx)
+		}
+		if c.backfill == "" {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, c.backfill)
+		return err
+	})
+}
+
+// fillModified copies the Last-Modified attribute into the MODIFIED column.
+func fillModified(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT ID, ATTRIBUTES FROM RESOURCES;`)
+	if err != nil {
+		return err
+	}
+	modified := map[string]string{}
+	for rows.Next() {
+		var id, attributes string
+		if err := rows.Scan(&id, &attributes); err != nil {
+			rows.Close()
+			return err
+		}
+		as, _ := ParseAttributes(attributes)
+		modified[id] = as[AttributeLastModified]
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, m := range modified {
+		if _, err := tx.ExecContext(ctx, `UPDATE RESOURCES SET MODIFIED = ? WHERE ID = ?;`, m, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *Archive) put(ctx context.Context, tx *sql.Tx, id string, attributes Attributes, data []byte, sum string) error {
+	as, err := a.putAttributes(ctx, tx, id, attributes, data, int64(len(data)), sum)
+	if err != nil {
+		return err
+	}
+	stored, err := a.encode(as, data)
+	if err != nil {
+		return err
+	}
+	sealed, err := a.seal(stored)
+	if err != nil {
+		return err
+	}
+	inline, external, err := a.externalize(sealed)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-	res := []Descriptor{}
-	for rows.Next() {
-		var id string
-		var attributes string
-		err = rows.Scan(&id, &attributes)
-		if err != nil {
-			return nil, err
-		}
-		as, err := ParseAttributes(attributes)
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, Descriptor{ID: id, Attributes: as})
+	if err := insert(ctx, tx, id, as, inline, int64(len(data)), external); err != nil {
+		return err
 	}
-	return res, nil
+	if a.versioning {
+		return a.recordVersion(ctx, tx, id, as, stored)
+	}
+	return nil
 }
 
-func (a *Archive) ListWithPrefix(prefix string) ([]Descriptor, error) {
-	rows, err := a.db.Query(`SELECT ID, ATTRIBUTES FROM RESOURCES WHERE ID LIKE ? ORDER BY ID;`, prefix+"%")
+// putAttributes returns the attributes to store with data of the given
+// length and checksum as the resource id, failing if they are not allowed.
+// data is only needed for WithImageMetadata.
+func (a *Archive) putAttributes(ctx context.Context, tx *sql.Tx, id string, attributes Attributes, data []byte, length int64, sum string) (Attributes, error) {
+	if !a.allowed(attributes) {
+		return nil, fmt.Errorf("%w: %q for %s", ErrUnsupportedType, attributes.MediaType(), id)
+	}
+	as := attributes.Clone()
+	as[AttributeLength] = fmt.Sprintf("%d", length)
+	if a.imageMetadata {
+		setImageMetadata(as, data)
+	}
+	a.stamp(ctx, as)
+	// the ETag of the previous data is carried over by callers storing loaded
+	// resources, so it is recomputed like the checksum; only an ETag set
+	// explicitly for the new data is kept
+	prev, err := storedETag(ctx, tx, id)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	res := []Descriptor{}
-	for rows.Next() {
-		var id string
-		var attributes string
-		err = rows.Scan(&id, &attributes)
-		if err != nil {
-			return nil, err
-		}
-		as, err := ParseAttributes(attributes)
+	if e := as[AttributeETag]; e == "" || e == prev || e == etag(as[AttributeChecksum]) {
+		as[AttributeETag] = etag(sum)
+	}
+	as[AttributeChecksum] = sum
+	if a.creationTime {
+		created, err := a.created(ctx, tx, id)
 		if err != nil {
 			return nil, err
 		}
-		res = append(res, Descriptor{ID: id, Attributes: as})
+		as[AttributeCreated] = created
 	}
-	return res, nil
-}
-
-func (a *Archive) Attributes(id string) (Attributes, error) {
-	row := a.db.QueryRow(`SELECT ATTRIBUTES FROM RESOURCES WHERE ID = ?;`, id)
-	var attributes string
-	err := row.Scan(&attributes)
-	if err != nil {
+	if err := a.checkAttributesSize(id, as); err != nil {
 		return nil, err
 	}
-	as, err := ParseAttributes(attributes)
-	if err != nil {
+	if err := checkQuota(ctx, tx, id, length); err != nil {
 		return nil, err
 	}
 	return as, nil
 }
 
-func (a *Archive) Load(id string) (Resource, error) {
-	row := a.db.QueryRow(`SELECT ATTRIBUTES, DATA FROM RESOURCES WHERE ID = ?;`, id)
+// insert writes the row of the resource id and records the change.
+func insert(ctx context.Context, tx *sql.Tx, id string, as Attributes, inline []byte, size int64, external sql.NullString) error {
+	if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO RESOURCES (ID, ATTRIBUTES, DATA, SIZE, MODIFIED, EXTERNAL) VALUES (?, ?, ?, ?, ?, ?);`, id, as.String(), inline, size, as[AttributeLastModified], external); err != nil {
+		return err
+	}
+	return recordChange(ctx, tx, id, changeStored)
+}
+
+// created returns the Created attribute of an existing resource, or the
+// current time if the resource is new or predates WithCreationTime.
+func (a *Archive) created(ctx context.Context, tx *sql.Tx, id string) (string, error) {
 	var attributes string
-	var data []byte
-	err := row.Scan(&attributes, &data)
-	if err != nil {
-		return Resource{}, err
+	err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
 	}
-	as, err := ParseAttributes(attributes)
+	as, _ := ParseAttributes(attributes)
+	if c := as[AttributeCreated]; c != "" {
+		return c, nil
+	}
+	return a.timestamp(), nil
+}
+
+func (a *Archive) remove(ctx context.Context, tx *sql.Tx, id string) (bool, error) {
+	r, err := tx.ExecContext(ctx, `DELETE FROM RESOURCES WHERE ID=?;`, id)
 	if err != nil {
-		return Resource{}, err
+		return false, err
 	}
-	res := Resource{
-		ID:         id,
-		Data:       data,
-		Attributes: as,
+	if n, _ := r.RowsAffected(); n == 0 {
+		return false, nil
 	}
-	return res, nil
+	return true, a.removed(ctx, tx, id)
 }
 
-func (a *Archive) Store(r Resource) error {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-
-	as := r.Attributes.Clone()
-	as[AttributeLength] = fmt.Sprintf("%d", len(r.Data))
-	as[AttributeLastModified] = time.Now().UTC().Format(time.RFC3339)
-
-	err := sqlutil.Transact(a.db, func(tx *sql.Tx) error {
-		if _, err := tx.Exec(`INSERT OR REPLACE INTO RESOURCES (ID, ATTRIBUTES, DATA) VALUES (?, ?, ?);`, r.ID, as.String(), r.Data); err != nil {
+// removed cleans up after the resource id was deleted from RESOURCES.
+func (a *Archive) removed(ctx context.Context, tx *sql.Tx, id string) error {
+	if a.versioning {
+		if err := recordTombstone(ctx, tx, id); err != nil {
 			return err
 		}
-		if _, err := tx.Exec(`UPDATE INFO SET VALUE = VALUE + 1 WHERE NAME = ?;`, InfoRevision); err != nil {
-			return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM EDGES WHERE FROM_ID = ? OR TO_ID = ?;`, id, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM ACCESS WHERE ID = ?;`, id); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM HOLDS WHERE ID = ?;`, id); err != nil {
+		return err
+	}
+	return recordChange(ctx, tx, id, changeDeleted)
+}
+
+func isMemory(dsn string) bool {
+	return dsn == ":memory:" || strings.HasPrefix(dsn, "file::memory:") || (strings.Contains(dsn, "mode=memory") && !strings.Contains(dsn, "cache=shared"))
+}
+
+func checkDriver(name string) error {
+	for _, d := range sql.Drivers() {
+		if d == name {
+			if name == DefaultDriver && !cgoEnabled {
+				return fmt.Errorf("%w: %q is a stub because the binary was built with CGO_ENABLED=0 and github.com/mattn/go-sqlite3 requires cgo; enable cgo or register a pure-Go driver and select it with WithDriver", ErrDriverUnavailable, name)
+			}
+			return nil
 		}
-		return nil
-	})
-	return err
+	}
+	return fmt.Errorf("%w: %q is not registered; import github.com/mattn/go-sqlite3 (which requires cgo) or register another driver and select it with WithDriver", ErrDriverUnavailable, name)
 }
 
-func (a *Archive) Delete(id string) error {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-	err := sqlutil.Transact(a.db, func(tx *sql.Tx) error {
-		r, err := tx.Exec(`DELETE FROM RESOURCES WHERE ID=?;`, id)
+// setAttributes updates the attributes of the resource id in a transaction
+// of its own, bumping the revision if they changed.
+func (a *Archive) setAttributes(id string, update func(Attributes)) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		if ok, err := exists(ctx, tx, id); err != nil {
+			return err
+		} else if !ok {
+			return sql.ErrNoRows
+		}
+		ok, err := a.updateAttributes(ctx, tx, id, update)
 		if err != nil {
 			return err
 		}
-		if a, _ := r.RowsAffected(); a > 0 {
-			if _, err := tx.Exec(`UPDATE INFO SET VALUE = VALUE + 1 WHERE NAME = ?;`, InfoRevision); err != nil {
-				return err
-			}
+		if ok {
+			return bumpRevision(ctx, tx)
 		}
 		return nil
 	})
-	return err
 }
 
-func (a *Archive) ImportFile(id string, file string) error {
-	bs, err := ioutil.ReadFile(file)
+// updateAttributes rewrites the attributes of an existing resource without
+// touching its data. It reports whether the attributes were changed.
+func (a *Archive) updateAttributes(ctx context.Context, tx *sql.Tx, id string, update func(Attributes)) (bool, error) {
+	var attributes string
+	err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
 	if err != nil {
-		return err
+		return false, err
+	}
+	as, err := ParseAttributes(attributes)
+	if err != nil {
+		return false, err
+	}
+	update(as)
+	if as.String() == attributes {
+		return false, nil
 	}
-	attr := Attributes{}
-	if typ := mime.TypeByExtension(filepath.Ext(file)); typ != "" {
-		attr[AttributeType] = typ
+	a.stamp(ctx, as)
+	if err := a.checkAttributesSize(id, as); err != nil {
+		return false, err
 	}
-	return a.Store(MakeResource(id, attr, bs))
+	if _, err := tx.ExecContext(ctx, `UPDATE RESOURCES SET ATTRIBUTES = ?, MODIFIED = ? WHERE ID = ?;`, as.String(), as[AttributeLastModified], id); err != nil {
+		return false, err
+	}
+	return true, recordChange(ctx, tx, id, changeStored)
 }
 
-func (a *Archive) ExportFile(id string, file string) error {
-	res, err := a.Load(id)
-	if err != nil {
-		return err
-	}
-	return ioutil.WriteFile(file, res.Data, 0644)
+func bumpRevision(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, `UPDATE INFO SET VALUE = VALUE + 1 WHERE NAME = ?;`, InfoRevision)
+	return err
 }
 
-func (a *Archive) Close() error {
-	return a.db.Close()
+func (a *Archive) now() time.Time {
+	return a.clock().UTC()
 }
 
-func (a *Archive) init() error {
-	a.mu.Lock()
-	defer a.mu.Unlock()
+// timestamp formats the current time as used in time valued attributes.
+func (a *Archive) timestamp() string {
+	return a.now().Format(time.RFC3339)
+}
+
+// context derives the context used for a single database operation,
+// bounded by the default timeout if one is configured.
+func (a *Archive) context() (context.Context, context.CancelFunc) {
+	return a.contextFrom(context.Background())
+}
+
+func (a *Archive) contextFrom(parent context.Context) (context.Context, context.CancelFunc) {
+	if a.timeout <= 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, a.timeout)
+}
+
+// translate maps errors caused by an expired operation context to ErrTimeout
+// and those caused by a cancelled one to its error.
+func (a *Archive) translate(ctx context.Context, err error) error {
+	if err != nil && a.isClosed() {
+		return ErrClosed
+	}
+	if err != nil && ctx.Err() == context.Canceled {
+		return ctx.Err()
+	}
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return err
+}
 
-	db, err := sql.Open("sqlite3", a.dsn)
+// write runs fn in a transaction of its own. Every method changing the
+// archive goes through write, which waits for the resources queued with
+// WithAsyncWrites to be committed first, so that the write applies after them,
+// and mirrors and publishes the changes fn made to resources.
+func (a *Archive) write(parent context.Context, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	p, err := a.prepare(parent, fn)
 	if err != nil {
 		return err
 	}
+	return p.commit()
+}
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS INFO (NAME TEXT, VALUE TEXT, PRIMARY KEY (NAME));`)
+// commit is like write but does not wait for the queue.
+func (a *Archive) commit(parent context.Context, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	p, err := a.begin(parent, fn)
 	if err != nil {
 		return err
 	}
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS RESOURCES (ID TEXT, ATTRIBUTES TEXT, DATA BLOB, PRIMARY KEY (ID));`)
+	return p.commit()
+}
+
+// prepare is like write but leaves the transaction open.
+func (a *Archive) prepare(parent context.Context, fn func(ctx context.Context, tx *sql.Tx) error) (*pending, error) {
+	if err := a.writable(); err != nil {
+		return nil, err
+	}
+	if a.queue != nil {
+		// keep the order with queued stores, whose errors are left to Flush
+		a.queue.wait()
+	}
+	return a.begin(parent, fn)
+}
+
+// A pending write is the open transaction of a write, which holds the lock of
+// the archive until it is committed or rolled back, together with the pending
+// write of the mirror and the events to publish once committed.
+type pending struct {
+	a      *Archive
+	ctx    context.Context
+	cancel context.CancelFunc
+	tx     *sql.Tx
+	mirror *pending
+	events []Event
+}
+
+// begin is like commit but leaves the transaction open.
+func (a *Archive) begin(parent context.Context, fn func(ctx context.Context, tx *sql.Tx) error) (*pending, error) {
+	a.mu.Lock()
+	ctx, cancel := a.contextFrom(parent)
+	p := &pending{a: a, ctx: ctx, cancel: cancel}
+	ok := false
+	defer func() {
+		// also when fn panics
+		if !ok {
+			p.rollback()
+		}
+	}()
+	tx, err := a.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return nil, a.translate(ctx, err)
+	}
+	p.tx = tx
+	// the changes are only looked up if somebody needs them
+	track := a.mirror != nil || a.watched()
+	var revision int
+	if track {
+		if err := tx.QueryRowContext(ctx, `SELECT VALUE FROM INFO WHERE NAME = ?;`, InfoRevision).Scan(&revision); err != nil {
+			return nil, a.translate(ctx, err)
+		}
+	}
+	if err := fn(ctx, tx); err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	if track {
+		changes, err := changedSince(ctx, tx, revision)
+		if err != nil {
+			return nil, a.translate(ctx, err)
+		}
+		if a.mirror != nil && len(changes) > 0 {
+			if p.mirror, err = a.stageMirror(ctx, tx, changes); err != nil {
+				return nil, a.translate(ctx, err)
+			}
+		}
+		p.events = events(changes)
+	}
+	ok = true
+	return p, nil
+}
+
+// commit commits the transaction and then that of the mirror, which is rolled
+// back if the first fails.
+func (p *pending) commit() error {
+	defer p.release()
+	if err := p.tx.Commit(); err != nil {
+		if p.mirror != nil {
+			p.mirror.rollback()
+		}
+		return p.a.translate(p.ctx, err)
 	}
-	_, err = db.Exec(`INSERT OR IGNORE INTO INFO (name, value) VALUES (?, ?);`, InfoRevision, "0")
+	p.a.publish(p.events)
+	if p.mirror != nil {
+		if err := p.mirror.commit(); err != nil {
+			return p.a.mirrorFailed(err)
+		}
+	}
+	return nil
+}
+
+func (p *pending) rollback() {
+	if p.tx != nil {
+		p.tx.Rollback()
+	}
+	if p.mirror != nil {
+		p.mirror.rollback()
+	}
+	p.release()
+}
+
+func (p *pending) release() {
+	p.cancel()
+	p.a.mu.Unlock()
+}
+
+func transact(ctx context.Context, db *sql.DB, txFunc func(*sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	a.db = db
-	return nil
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = tx.Commit()
+	}()
+	return txFunc(tx)
 }
 
 func GenericJSON(id string, v interface{}) Resource {
@@ -251,6 +1756,25 @@ func LoadXML(a *Archive, id string, v interface{}) error {
 	return nil
 }
 
+// StoreStructured stores v encoded as JSON under id+".json" and as XML under
+// id+".xml", so that the HTTP handler can negotiate either form for id.
+func (a *Archive) StoreStructured(id string, v interface{}) error {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	x, err := GenericXML(id+".xml", v)
+	if err != nil {
+		return err
+	}
+	return a.Batch(func(b *Batch) error {
+		if err := b.Store(MakeResource(id+".json", Attributes{AttributeType: TypeApplicationJSON}, j)); err != nil {
+			return err
+		}
+		return b.Store(x)
+	})
+}
+
 func TextPlain(id string, text string) Resource {
 	return MakeResource(id, Attributes{AttributeType: TypeTextPlain}, []byte(text))
 }
@@ -259,6 +1783,12 @@ func JPEG(id string, data []byte) Resource {
 	return MakeResource(id, Attributes{AttributeType: TypeImageJPEG}, data)
 }
 
+// Redirect makes a resource that the Handler serves as a redirect to
+// location, which may be a URL or the ID of another resource.
+func Redirect(id string, location string, status int) Resource {
+	return MakeResource(id, Attributes{AttributeType: TypeRedirect, AttributeLocation: location, AttributeStatus: strconv.Itoa(status)}, nil)
+}
+
 func MakeResource(id string, as Attributes, data []byte) Resource {
 	return Resource{
 		ID:         id,
@@ -272,6 +1802,28 @@ type Descriptor struct {
 	Attributes Attributes
 }
 
+// descriptorKeys are the attributes shown by Descriptor.String, sorted.
+var descriptorKeys = []string{AttributeLastModified, AttributeLength, AttributeType}
+
+// String renders the ID of the descriptor followed by its Last-Modified,
+// Length and Type attributes on a single line, omitting those that are not
+// set, e.g. "/a (Length: 3, Type: text/plain)".
+func (d Descriptor) String() string {
+	var parts []string
+	for _, k := range descriptorKeys {
+		if v, ok := d.Attributes[k]; ok {
+			parts = append(parts, k+": "+v)
+		}
+	}
+	if len(parts) == 0 {
+		return d.ID
+	}
+	return d.ID + " (" + strings.Join(parts, ", ") + ")"
+}
+
+// Resource is a stored item. A nil Data means the resource has no data,
+// whereas an empty, non-nil Data is present but zero-length; the distinction
+// survives Store and Load as well as String and ParseResource.
 type Resource struct {
 	ID         string
 	Attributes Attributes
@@ -289,7 +1841,7 @@ func (r Resource) String() string {
 	}
 	if r.Data != nil {
 		out = append(out, "\r\n")
-		switch r.Attributes[AttributeType] {
+		switch r.Attributes.MediaType() {
 		case TypeTextPlain:
 			out = append(out, string(r.Data))
 		default:
@@ -305,8 +1857,102 @@ func (r Resource) String() string {
 	return buf.String()
 }
 
+// ParseResource parses the format produced by Resource.String.
+func ParseResource(s string) (Resource, error) {
+	if s == "" {
+		return Resource{}, nil
+	}
+	const header = "RESOURCE "
+	nl := strings.Index(s, "\r\n")
+	if !strings.HasPrefix(s, header) || nl < 0 {
+		return Resource{}, fmt.Errorf("archive: invalid resource header")
+	}
+	r := Resource{ID: s[len(header):nl]}
+	rest := s[nl+2:]
+
+	attributes, body, hasBody := rest, "", false
+	if strings.HasPrefix(rest, "\r\n") {
+		attributes, body, hasBody = "", rest[2:], true
+	} else if i := strings.Index(rest, "\r\n\r\n"); i >= 0 {
+		attributes, body, hasBody = rest[:i+2], rest[i+4:], true
+	}
+	as, err := ParseAttributes(attributes)
+	if err != nil {
+		return Resource{}, err
+	}
+	r.Attributes = as
+	if !hasBody {
+		return r, nil
+	}
+	if !strings.HasSuffix(body, "\r\n") {
+		return Resource{}, fmt.Errorf("archive: unterminated resource data")
+	}
+	body = body[:len(body)-2]
+	switch as.MediaType() {
+	case TypeTextPlain:
+		r.Data = []byte(body)
+	default:
+		data, err := parseBytes(body)
+		if err != nil {
+			return Resource{}, err
+		}
+		r.Data = data
+	}
+	return r, nil
+}
+
+// parseBytes parses a byte slice formatted with %v, e.g. "[1 2 3]".
+func parseBytes(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("archive: invalid resource data")
+	}
+	fields := strings.Fields(s[1 : len(s)-1])
+	data := make([]byte, 0, len(fields))
+	for _, f := range fields {
+		b, err := strconv.ParseUint(f, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("archive: invalid resource data: %w", err)
+		}
+		data = append(data, byte(b))
+	}
+	return data, nil
+}
+
+// Equal reports whether r and other have the same ID, data and attributes,
+// ignoring volatile attributes such as Last-Modified that change on every
+// store of identical content.
+func (r Resource) Equal(other Resource) bool {
+	return r.equal(other, false)
+}
+
+// StrictEqual is like Equal but also compares volatile attributes.
+func (r Resource) StrictEqual(other Resource) bool {
+	return r.equal(other, true)
+}
+
+func (r Resource) equal(other Resource, volatile bool) bool {
+	if r.ID != other.ID || !bytes.Equal(r.Data, other.Data) {
+		return false
+	}
+	return r.Attributes.equal(other.Attributes, volatile)
+}
+
 type Attributes map[string]string
 
+func (as Attributes) equal(other Attributes, volatile bool) bool {
+	for _, m := range []struct{ x, y Attributes }{{as, other}, {other, as}} {
+		for k, v := range m.x {
+			if !volatile && isVolatileAttribute(k) {
+				continue
+			}
+			if w, ok := m.y[k]; !ok || v != w {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (as Attributes) String() string {
 	buf := &bytes.Buffer{}
 	for _, e := range as.Entries() {
@@ -319,6 +1965,48 @@ func (as Attributes) String() string {
 	return buf.String()
 }
 
+func (as Attributes) Has(key string) bool {
+	_, ok := as[key]
+	return ok
+}
+
+func (as Attributes) Delete(key string) {
+	delete(as, key)
+}
+
+// Keys returns the attribute keys in sorted order.
+func (as Attributes) Keys() []string {
+	keys := make([]string, 0, len(as))
+	for k := range as {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MediaType returns the Type attribute without any parameters.
+func (as Attributes) MediaType() string {
+	typ, _, err := mime.ParseMediaType(as[AttributeType])
+	if err != nil {
+		return as[AttributeType]
+	}
+	return typ
+}
+
+// Charset returns the charset parameter of the Type attribute, if any.
+func (as Attributes) Charset() string {
+	_, params, err := mime.ParseMediaType(as[AttributeType])
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}
+
+// Filename returns the suggested file name for saving the data.
+func (as Attributes) Filename() string {
+	return as[AttributeFilename]
+}
+
 func (as Attributes) Entries() Entries {
 	es := Entries{}
 	for k, v := range as {
@@ -351,6 +2039,45 @@ func ParseAttributes(data string) (Attributes, error) {
 	return as, nil
 }
 
+// IsManagedAttribute reports whether key is maintained by the archive itself
+// and therefore ignored when supplied by callers.
+func IsManagedAttribute(key string) bool {
+	switch key {
+	case AttributeChecksum, AttributeCreated, AttributeEncoding, AttributeLength, AttributeLastModified, AttributeLastModifiedBy:
+		return true
+	}
+	return false
+}
+
+const checksumPrefix = "sha256:"
+
+// Checksum returns the value of the Checksum attribute for data.
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return checksumPrefix + hex.EncodeToString(sum[:])
+}
+
+// withDefaultCharset adds charset=utf-8 to text types that carry no charset.
+func withDefaultCharset(typ string) string {
+	mt, params, err := mime.ParseMediaType(typ)
+	if err != nil || !strings.HasPrefix(mt, "text/") || params["charset"] != "" {
+		return typ
+	}
+	params["charset"] = "utf-8"
+	return mime.FormatMediaType(mt, params)
+}
+
+func splitChecksum(sum string) (algo, digest string) {
+	if i := strings.Index(sum, ":"); i >= 0 {
+		return sum[:i], sum[i+1:]
+	}
+	return "", sum
+}
+
+func isVolatileAttribute(key string) bool {
+	return key == AttributeLastModified || key == AttributeLastModifiedBy || key == AttributeCreated
+}
+
 type Entry struct {
 	Key   string
 	Value string
@@ -363,13 +2090,25 @@ func (s Entries) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s Entries) Less(i, j int) bool { return s[i].Key < s[j].Key }
 
 const (
-	AttributeEncoding     = "Encoding"
-	AttributeETag         = "ETag"
-	AttributeExpires      = "Expires"
-	AttributeLastModified = "Last-Modified"
-	AttributeLabel        = "Label"
-	AttributeLength       = "Length"
-	AttributeType         = "Type"
+	AttributeChecksum           = "Checksum"
+	AttributeCreated            = "Created"
+	AttributeDerivedFrom        = "Derived-From"
+	AttributeDerivedFromVersion = "Derived-From-Version"
+	AttributeEncoding           = "Encoding"
+	AttributeETag               = "ETag"
+	AttributeExpires            = "Expires"
+	AttributeFilename           = "Filename"
+	AttributeImageHeight        = "Image-Height"
+	AttributeImageWidth         = "Image-Width"
+	AttributeLastModified       = "Last-Modified"
+	AttributeLastModifiedBy     = "Last-Modified-By"
+	AttributeLabel              = "Label"
+	AttributeLength             = "Length"
+	AttributeLocation           = "Location"
+	AttributePinned             = "Pinned"
+	AttributeSchema             = "Schema"
+	AttributeStatus             = "Status"
+	AttributeType               = "Type"
 )
 
 const (
@@ -379,6 +2118,7 @@ const (
 	TypeImageJPEG       = "image/jpeg"
 	TypeImagePNG        = "image/png"
 	TypeImageSVG        = "image/svg+xml"
+	TypeRedirect        = "application/x-redirect"
 	TypeTextCSV         = "text/csv"
 	TypeTextHTML        = "text/html"
 	TypeTextPlain       = "text/plain"
@@ -386,9 +2126,15 @@ const (
 
 const (
 	EncodingIdentity = "identity"
+	EncodingBrotli   = "br"
 	EncodingGZIP     = "gzip"
 )
 
 const (
 	InfoRevision = "Revision"
+	InfoKeyCheck = "KeyCheck"
+)
+
+const (
+	DefaultDriver = "sqlite3"
 )
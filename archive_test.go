@@ -1,8 +1,23 @@
 package archive
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestResourceString(t *testing.T) {
@@ -38,6 +53,40 @@ func TestResourceString(t *testing.T) {
 	}
 }
 
+func TestDescriptorString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Descriptor
+		out  string
+	}{
+		{
+			name: "bare",
+			in:   Descriptor{ID: "/a"},
+			out:  "/a",
+		},
+		{
+			name: "summary",
+			in: Descriptor{
+				ID: "/a",
+				Attributes: Attributes{
+					AttributeType:         TypeTextPlain,
+					AttributeLength:       "3",
+					AttributeLastModified: "2020-01-01T00:00:00Z",
+					AttributeLabel:        "hidden",
+				},
+			},
+			out: "/a (Last-Modified: 2020-01-01T00:00:00Z, Length: 3, Type: text/plain)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.in.String(); test.out != got {
+				t.Errorf("expected %q but got %q", test.out, got)
+			}
+		})
+	}
+}
+
 func TestAttributesString(t *testing.T) {
 	tests := []struct {
 		name string
@@ -193,3 +242,1379 @@ func TestArchive(t *testing.T) {
 	}
 
 }
+
+func TestDefaultTimeout(t *testing.T) {
+	a, err := Open(":memory:", WithDefaultTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.Store(TextPlain("/", "foo")); err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+
+	a.timeout = 10 * time.Millisecond
+	ctx, cancel := a.context()
+	defer cancel()
+	var n int
+	slow := `WITH RECURSIVE C(X) AS (SELECT 1 UNION ALL SELECT X + 1 FROM C WHERE X < 1000000000) SELECT COUNT(*) FROM C;`
+	err = a.translate(ctx, a.db.QueryRowContext(ctx, slow).Scan(&n))
+	if err != ErrTimeout {
+		t.Fatalf("expected slow query to fail with %v but got %v", ErrTimeout, err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected %v to match %v", err, context.DeadlineExceeded)
+	}
+
+	a.timeout = time.Nanosecond
+	if _, err := a.List(); err != ErrTimeout {
+		t.Fatalf("expected list to fail with %v but got %v", ErrTimeout, err)
+	}
+	if _, err := a.Load("/"); err != ErrTimeout {
+		t.Fatalf("expected load to fail with %v but got %v", ErrTimeout, err)
+	}
+}
+
+func TestExportApplyAttributes(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(MakeResource("/a", Attributes{AttributeLabel: "A"}, []byte("a")))
+	a.Store(MakeResource("/b", Attributes{AttributeLabel: "B"}, []byte("b")))
+	rev := a.Revision()
+
+	buf := &bytes.Buffer{}
+	if err := a.ExportAttributes(buf); err != nil {
+		t.Fatalf("expected export to succeed: %s", err)
+	}
+	m := map[string]Attributes{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("expected export to be valid json: %s", err)
+	}
+	if got := m["/b"][AttributeLabel]; got != "B" {
+		t.Fatalf("expected label %q but got %q", "B", got)
+	}
+
+	m["/b"][AttributeLabel] = "Bee"
+	m["/b"][AttributeLength] = "1000"
+	buf.Reset()
+	json.NewEncoder(buf).Encode(m)
+
+	n, err := a.ApplyAttributes(buf)
+	if err != nil {
+		t.Fatalf("expected apply to succeed: %s", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected %d resource to be updated but got %d", 1, n)
+	}
+	if got := a.Revision(); got != rev+1 {
+		t.Fatalf("expected revision to be %d but was %d", rev+1, got)
+	}
+	res, err := a.Load("/b")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	if got := res.Attributes[AttributeLabel]; got != "Bee" {
+		t.Fatalf("expected label %q but got %q", "Bee", got)
+	}
+	if got := res.Attributes[AttributeLength]; got != "1" {
+		t.Fatalf("expected managed length %q to be kept but got %q", "1", got)
+	}
+	if string(res.Data) != "b" {
+		t.Fatalf("expected data to be unchanged but got %q", res.Data)
+	}
+}
+
+func TestStoreTee(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	data := bytes.Repeat([]byte("upload "), 1000)
+	tee := &bytes.Buffer{}
+	err = a.StoreTee("/upload", Attributes{AttributeType: TypeTextPlain}, bytes.NewReader(data), tee)
+	if err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+	if !bytes.Equal(data, tee.Bytes()) {
+		t.Fatalf("expected tee to receive all data")
+	}
+	res, err := a.Load("/upload")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	if !bytes.Equal(data, res.Data) {
+		t.Fatalf("expected stored data to match")
+	}
+	if got := res.Attributes[AttributeLength]; got != "7000" {
+		t.Fatalf("expected length %q but got %q", "7000", got)
+	}
+	if got, want := res.Attributes[AttributeChecksum], Checksum(data); got != want {
+		t.Fatalf("expected checksum %q but got %q", want, got)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	err = a.Batch(func(b *Batch) error {
+		for i := 0; i < 100; i++ {
+			if err := b.Store(TextPlain(fmt.Sprintf("/%03d", i), "burst")); err != nil {
+				return err
+			}
+		}
+		return b.Delete("/000")
+	})
+	if err != nil {
+		t.Fatalf("expected batch to succeed: %s", err)
+	}
+	if rev := a.Revision(); rev != 1 {
+		t.Fatalf("expected revision to be %d but was %d", 1, rev)
+	}
+	ds, _ := a.List()
+	if len(ds) != 99 {
+		t.Fatalf("expected %d resources but got %d", 99, len(ds))
+	}
+
+	err = a.Batch(func(b *Batch) error {
+		b.Store(TextPlain("/rolled-back", "never"))
+		return fmt.Errorf("abort")
+	})
+	if err == nil {
+		t.Fatalf("expected batch to fail")
+	}
+	if _, err := a.Load("/rolled-back"); err == nil {
+		t.Fatalf("expected failed batch to be rolled back")
+	}
+	if rev := a.Revision(); rev != 1 {
+		t.Fatalf("expected revision to be %d but was %d", 1, rev)
+	}
+}
+
+func TestBatchMirroredAndWatched(t *testing.T) {
+	secondary, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secondary.Close()
+	a, err := Open(":memory:", WithMirror(secondary, MirrorStrict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/old", "old"))
+	events, unwatch := a.Watch()
+	defer unwatch()
+	if err := a.StoreStructured("/doc", structuredDoc{Title: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Batch(func(b *Batch) error { return b.Delete("/old") }); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"/doc.json", "/doc.xml"} {
+		if ok, _ := secondary.Exists(id); !ok {
+			t.Fatalf("expected %s to be mirrored", id)
+		}
+	}
+	if ok, _ := secondary.Exists("/old"); ok {
+		t.Fatalf("expected the delete of /old to be mirrored")
+	}
+	want := []Event{
+		{ID: "/doc.json", Kind: EventStored, Revision: 2},
+		{ID: "/doc.xml", Kind: EventStored, Revision: 2},
+		{ID: "/old", Kind: EventDeleted, Revision: 3},
+	}
+	for _, w := range want {
+		if e := <-events; e != w {
+			t.Fatalf("expected %v but got %v", w, e)
+		}
+	}
+}
+
+func TestUnregisteredDriver(t *testing.T) {
+	_, err := Open(":memory:", WithDriver("sqlite3-missing"))
+	if !errors.Is(err, ErrDriverUnavailable) {
+		t.Fatalf("expected %v but got %v", ErrDriverUnavailable, err)
+	}
+	for _, s := range []string{`"sqlite3-missing"`, "cgo", "WithDriver"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected error to mention %s: %s", s, err)
+		}
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	sum := sha256.Sum256([]byte("foo"))
+	want := hex.EncodeToString(sum[:])
+
+	a.Store(TextPlain("/stored", "foo"))
+	if _, err := a.db.Exec(`INSERT INTO RESOURCES (ID, ATTRIBUTES, DATA) VALUES (?, ?, ?);`, "/legacy", "Type: text/plain\r\n", []byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"/stored", "/legacy"} {
+		algo, got, err := a.ContentHash(id)
+		if err != nil {
+			t.Fatalf("expected content hash of %s to succeed: %s", id, err)
+		}
+		if algo != "sha256" || got != want {
+			t.Errorf("expected %s:%s for %s but got %s:%s", "sha256", want, id, algo, got)
+		}
+	}
+	if _, _, err := a.ContentHash("/missing"); err == nil {
+		t.Fatalf("expected content hash of missing resource to fail")
+	}
+}
+
+func TestCharset(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	typ := "text/plain; charset=iso-8859-1"
+	a.Store(MakeResource("/latin1", Attributes{AttributeType: typ}, []byte("caf\xe9")))
+	res, err := a.Load("/latin1")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	if got := res.Attributes[AttributeType]; got != typ {
+		t.Fatalf("expected type %q but got %q", typ, got)
+	}
+	if got := res.Attributes.Charset(); got != "iso-8859-1" {
+		t.Fatalf("expected charset %q but got %q", "iso-8859-1", got)
+	}
+	if got := res.Attributes.MediaType(); got != TypeTextPlain {
+		t.Fatalf("expected media type %q but got %q", TypeTextPlain, got)
+	}
+
+	mime.AddExtensionType(".archivetest", "text/x-archive-test")
+	file := filepath.Join(t.TempDir(), "notes.archivetest")
+	ioutil.WriteFile(file, []byte("notes"), 0644)
+	if err := a.ImportFile("/notes", file); err != nil {
+		t.Fatalf("expected import to succeed: %s", err)
+	}
+	as, _ := a.Attributes("/notes")
+	if got, want := as[AttributeType], "text/x-archive-test; charset=utf-8"; got != want {
+		t.Fatalf("expected type %q but got %q", want, got)
+	}
+	if got, want := as.Filename(), "notes.archivetest"; got != want {
+		t.Fatalf("expected filename %q but got %q", want, got)
+	}
+}
+
+func TestListBySize(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, n := range []int{0, 10, 100, 1000, 10000} {
+		a.Store(MakeResource(fmt.Sprintf("/%d", n), Attributes{}, make([]byte, n)))
+	}
+	tests := []struct {
+		name     string
+		min, max int64
+		out      []string
+	}{
+		{name: "band", min: 10, max: 1000, out: []string{"/1000", "/100", "/10"}},
+		{name: "open", min: 1000, max: -1, out: []string{"/10000", "/1000"}},
+		{name: "empty", min: 0, max: 0, out: []string{"/0"}},
+		{name: "none", min: 11, max: 99, out: []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ds, err := a.ListBySize(test.min, test.max)
+			if err != nil {
+				t.Fatalf("expected list to succeed: %s", err)
+			}
+			got := []string{}
+			for _, d := range ds {
+				got = append(got, d.ID)
+			}
+			if !reflect.DeepEqual(test.out, got) {
+				t.Errorf("expected %v but got %v", test.out, got)
+			}
+		})
+	}
+}
+
+func TestSizeColumnMigration(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`CREATE TABLE RESOURCES (ID TEXT, ATTRIBUTES TEXT, DATA BLOB, PRIMARY KEY (ID));`)
+	db.Exec(`INSERT INTO RESOURCES (ID, ATTRIBUTES, DATA) VALUES (?, ?, ?);`, "/old", "Length: 3\r\n", []byte("old"))
+	db.Close()
+
+	a, err := Open(file)
+	if err != nil {
+		t.Fatalf("expected open to migrate the archive: %s", err)
+	}
+	defer a.Close()
+	ds, err := a.ListBySize(3, 3)
+	if err != nil || len(ds) != 1 {
+		t.Fatalf("expected migrated resource to be listed by size: %v %v", ds, err)
+	}
+}
+
+func TestRecent(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a, err := Open(":memory:", WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, id := range []string{"/a", "/b", "/c", "/d"} {
+		a.Store(TextPlain(id, id))
+		now = now.Add(time.Minute)
+	}
+	a.Store(TextPlain("/e", "e"))
+	a.Pin("/a")
+
+	ds, err := a.Recent(3)
+	if err != nil {
+		t.Fatalf("expected recent to succeed: %s", err)
+	}
+	var got []string
+	for _, d := range ds {
+		got = append(got, d.ID)
+	}
+	if want := []string{"/a", "/e", "/d"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+}
+
+func TestWithClock(t *testing.T) {
+	now := time.Date(2020, 2, 29, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+	a, err := Open(":memory:", WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/", "foo"))
+	as, _ := a.Attributes("/")
+	if got, want := as[AttributeLastModified], "2020-02-29T11:30:00Z"; got != want {
+		t.Fatalf("expected last modified %q but got %q", want, got)
+	}
+
+	now = now.Add(time.Hour)
+	a.Pin("/")
+	as, _ = a.Attributes("/")
+	if got, want := as[AttributeLastModified], "2020-02-29T12:30:00Z"; got != want {
+		t.Fatalf("expected last modified %q but got %q", want, got)
+	}
+}
+
+func TestWithCreationTime(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a, err := Open(":memory:", WithClock(func() time.Time { return now }), WithCreationTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/", "foo"))
+	now = now.Add(time.Hour)
+	a.Store(MakeResource("/", Attributes{AttributeCreated: "bogus"}, []byte("bar")))
+
+	as, _ := a.Attributes("/")
+	if got, want := as[AttributeCreated], "2020-01-01T00:00:00Z"; got != want {
+		t.Fatalf("expected created %q but got %q", want, got)
+	}
+	if got, want := as[AttributeLastModified], "2020-01-01T01:00:00Z"; got != want {
+		t.Fatalf("expected last modified %q but got %q", want, got)
+	}
+}
+
+func TestAttributesHasDeleteKeys(t *testing.T) {
+	as := Attributes{
+		AttributeType:  TypeTextPlain,
+		AttributeLabel: "",
+		"Foo":          "Bar",
+	}
+	if !as.Has(AttributeLabel) {
+		t.Errorf("expected empty valued %s to be present", AttributeLabel)
+	}
+	if as.Has(AttributeETag) {
+		t.Errorf("expected %s to be absent", AttributeETag)
+	}
+	if want, got := []string{"Foo", AttributeLabel, AttributeType}, as.Keys(); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected keys %v but got %v", want, got)
+	}
+	as.Delete("Foo")
+	as.Delete("Missing")
+	if as.Has("Foo") {
+		t.Errorf("expected Foo to be deleted")
+	}
+	if want, got := []string{AttributeLabel, AttributeType}, as.Keys(); !reflect.DeepEqual(want, got) {
+		t.Errorf("expected keys %v but got %v", want, got)
+	}
+	if got := (Attributes{}).Keys(); len(got) != 0 {
+		t.Errorf("expected no keys but got %v", got)
+	}
+}
+
+func TestResourceEqual(t *testing.T) {
+	base := MakeResource("/", Attributes{AttributeType: TypeTextPlain, AttributeLastModified: "2020-01-01T00:00:00Z"}, []byte("foo"))
+	tests := []struct {
+		name   string
+		other  Resource
+		equal  bool
+		strict bool
+	}{
+		{name: "same", other: MakeResource("/", Attributes{AttributeType: TypeTextPlain, AttributeLastModified: "2020-01-01T00:00:00Z"}, []byte("foo")), equal: true, strict: true},
+		{name: "modified", other: MakeResource("/", Attributes{AttributeType: TypeTextPlain, AttributeLastModified: "2021-01-01T00:00:00Z"}, []byte("foo")), equal: true, strict: false},
+		{name: "unmodified", other: MakeResource("/", Attributes{AttributeType: TypeTextPlain}, []byte("foo")), equal: true, strict: false},
+		{name: "data", other: MakeResource("/", Attributes{AttributeType: TypeTextPlain, AttributeLastModified: "2020-01-01T00:00:00Z"}, []byte("bar")), equal: false, strict: false},
+		{name: "id", other: MakeResource("/x", Attributes{AttributeType: TypeTextPlain, AttributeLastModified: "2020-01-01T00:00:00Z"}, []byte("foo")), equal: false, strict: false},
+		{name: "attributes", other: MakeResource("/", Attributes{AttributeType: TypeTextHTML, AttributeLastModified: "2020-01-01T00:00:00Z"}, []byte("foo")), equal: false, strict: false},
+		{name: "extra", other: MakeResource("/", Attributes{AttributeType: TypeTextPlain, AttributeLabel: "x", AttributeLastModified: "2020-01-01T00:00:00Z"}, []byte("foo")), equal: false, strict: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := base.Equal(test.other); got != test.equal {
+				t.Errorf("expected equal to be %t but got %t", test.equal, got)
+			}
+			if got := test.other.Equal(base); got != test.equal {
+				t.Errorf("expected equal to be symmetric")
+			}
+			if got := base.StrictEqual(test.other); got != test.strict {
+				t.Errorf("expected strict equal to be %t but got %t", test.strict, got)
+			}
+		})
+	}
+}
+
+func TestNilAndEmptyData(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(MakeResource("/nil", Attributes{AttributeType: TypeTextPlain}, nil))
+	a.Store(MakeResource("/empty", Attributes{AttributeType: TypeTextPlain}, []byte{}))
+
+	nilRes, err := a.Load("/nil")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	if nilRes.Data != nil {
+		t.Fatalf("expected nil data but got %#v", nilRes.Data)
+	}
+	emptyRes, err := a.Load("/empty")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	if emptyRes.Data == nil || len(emptyRes.Data) != 0 {
+		t.Fatalf("expected empty data but got %#v", emptyRes.Data)
+	}
+
+	for _, res := range []Resource{nilRes, emptyRes} {
+		parsed, err := ParseResource(res.String())
+		if err != nil {
+			t.Fatalf("expected parse to succeed: %s", err)
+		}
+		if (parsed.Data == nil) != (res.Data == nil) || !parsed.StrictEqual(res) {
+			t.Errorf("expected %#v but got %#v", res, parsed)
+		}
+	}
+}
+
+func TestParseResource(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Resource
+	}{
+		{name: "none", in: Resource{}},
+		{name: "text", in: TextPlain("/", "foo\r\n\r\nbar")},
+		{name: "binary", in: MakeResource("/bin", Attributes{AttributeType: TypeImagePNG}, []byte{0, 1, 255})},
+		{name: "no-attributes", in: MakeResource("/bare", Attributes{}, []byte{})},
+		{name: "no-data", in: MakeResource("/meta", Attributes{AttributeLabel: "x"}, nil)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseResource(test.in.String())
+			if err != nil {
+				t.Fatalf("expected parse to succeed: %s", err)
+			}
+			if got.String() != test.in.String() {
+				t.Errorf("expected:\n%sgot:\n%s", test.in, got)
+			}
+		})
+	}
+	if _, err := ParseResource("garbage"); err == nil {
+		t.Errorf("expected invalid input to fail")
+	}
+}
+
+func TestOpenSharesFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	a1, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := Open("file:" + filepath.Join(filepath.Dir(file), ".", "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a1 != a2 {
+		t.Fatalf("expected the same archive for the same file")
+	}
+	m1, _ := Open(":memory:")
+	m2, _ := Open(":memory:")
+	defer m1.Close()
+	defer m2.Close()
+	if m1 == m2 {
+		t.Fatalf("expected in-memory archives not to be shared")
+	}
+
+	if err := a1.Close(); err != nil {
+		t.Fatalf("expected close to succeed: %s", err)
+	}
+	if err := a2.Store(TextPlain("/", "still open")); err != nil {
+		t.Fatalf("expected archive to stay open for the remaining holder: %s", err)
+	}
+	if err := a2.Close(); err != nil {
+		t.Fatalf("expected close to succeed: %s", err)
+	}
+	if err := a2.Store(TextPlain("/", "closed")); err == nil {
+		t.Fatalf("expected archive to be closed after the last close")
+	}
+
+	a3, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a3.Close()
+	if a3 == a1 {
+		t.Fatalf("expected a fresh archive after the last close")
+	}
+	if res, err := a3.Load("/"); err != nil || string(res.Data) != "still open" {
+		t.Fatalf("expected stored data to persist: %q %v", res.Data, err)
+	}
+}
+
+type upperReader struct {
+	r io.Reader
+}
+
+func (u upperReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	copy(p, bytes.ToUpper(p[:n]))
+	return n, err
+}
+
+func TestLoadThrough(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/text", "hello world"))
+	rc, as, err := a.LoadThrough("/text", func(r io.Reader) io.Reader {
+		return upperReader{r: r}
+	})
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	defer rc.Close()
+	bs, _ := ioutil.ReadAll(rc)
+	if string(bs) != "HELLO WORLD" {
+		t.Fatalf("expected transformed data but got %q", bs)
+	}
+	if as.MediaType() != TypeTextPlain {
+		t.Fatalf("expected attributes of the resource but got %v", as)
+	}
+
+	if _, _, err := a.LoadThrough("/missing", func(r io.Reader) io.Reader { return r }); err != sql.ErrNoRows {
+		t.Fatalf("expected %v but got %v", sql.ErrNoRows, err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	a, err := Open(file+"?_journal_mode=WAL", WithVacuumOnShutdown())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Store(TextPlain("/", "foo"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := a.Shutdown(ctx); err != nil {
+		t.Fatalf("expected shutdown to succeed: %s", err)
+	}
+	if err := a.Shutdown(ctx); err != nil {
+		t.Fatalf("expected repeated shutdown to succeed: %s", err)
+	}
+	if err := a.Store(TextPlain("/", "bar")); err != ErrClosed {
+		t.Fatalf("expected %v but got %v", ErrClosed, err)
+	}
+	if _, err := a.Load("/"); err != ErrClosed {
+		t.Fatalf("expected %v but got %v", ErrClosed, err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("expected close after shutdown to succeed: %s", err)
+	}
+
+	b, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if r, err := b.Load("/"); err != nil || string(r.Data) != "foo" {
+		t.Fatalf("expected data to survive shutdown: %v %v", r, err)
+	}
+}
+
+func TestWithPageSize(t *testing.T) {
+	dir := t.TempDir()
+	sizes := map[int]int64{}
+	for _, pageSize := range []int{512, 65536} {
+		file := filepath.Join(dir, fmt.Sprintf("archive-%d.db", pageSize))
+		a, err := Open(file, WithPageSize(pageSize), WithCacheSize(-1024))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 20; i++ {
+			a.Store(TextPlain(fmt.Sprintf("/%d", i), "small"))
+		}
+		var got, cache int
+		a.db.QueryRow(`PRAGMA page_size;`).Scan(&got)
+		a.db.QueryRow(`PRAGMA cache_size;`).Scan(&cache)
+		a.Close()
+		if got != pageSize {
+			t.Fatalf("expected page size %d but got %d", pageSize, got)
+		}
+		if cache != -1024 {
+			t.Fatalf("expected cache size %d but got %d", -1024, cache)
+		}
+		fi, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[pageSize] = fi.Size()
+	}
+	if sizes[512] >= sizes[65536] {
+		t.Fatalf("expected small pages to yield a smaller file for small resources: %v", sizes)
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	truncated := filepath.Join(dir, "truncated.db")
+	a, err := Open(truncated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		a.Store(TextPlain(fmt.Sprintf("/%d", i), strings.Repeat("x", 1000)))
+	}
+	a.Close()
+	fi, _ := os.Stat(truncated)
+	os.Truncate(truncated, fi.Size()/2)
+
+	garbage := filepath.Join(dir, "garbage.db")
+	ioutil.WriteFile(garbage, bytes.Repeat([]byte("garbage!"), 1000), 0644)
+
+	for _, file := range []string{truncated, garbage} {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			a, err := Open(file)
+			if err == nil {
+				a.Close()
+			}
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("expected %v but got %v", ErrCorrupt, err)
+			}
+		})
+	}
+}
+
+func TestCloneToMemory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "template.db")
+	a, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.Store(TextPlain("/a", "a"))
+	a.Store(TextPlain("/b", "b"))
+
+	c, err := a.CloneToMemory()
+	if err != nil {
+		t.Fatalf("expected clone to succeed: %s", err)
+	}
+	defer c.Close()
+	if r, err := c.Load("/a"); err != nil || string(r.Data) != "a" {
+		t.Fatalf("expected clone to contain the data: %v %v", r, err)
+	}
+	if got, want := c.Revision(), a.Revision(); got != want {
+		t.Fatalf("expected revision %d but got %d", want, got)
+	}
+
+	c.Store(TextPlain("/a", "changed"))
+	c.Delete("/b")
+	if r, _ := a.Load("/a"); string(r.Data) != "a" {
+		t.Fatalf("expected original to be unchanged but got %q", r.Data)
+	}
+	if ds, _ := a.List(); len(ds) != 2 {
+		t.Fatalf("expected original to keep %d resources but got %d", 2, len(ds))
+	}
+}
+
+func TestCloneToMemoryIsolated(t *testing.T) {
+	secondary, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secondary.Close()
+	a, err := Open(":memory:", WithMirror(secondary, MirrorStrict), WithAsyncWrites(10, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	c, err := a.CloneToMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Store(TextPlain("/a", "a")); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := c.Exists("/a"); !ok {
+		t.Fatalf("expected the store to be committed right away")
+	}
+	if ok, _ := secondary.Exists("/a"); ok {
+		t.Fatalf("expected the store not to be mirrored")
+	}
+}
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(filepath.Join(dir, "archive.db"), WithInlineThreshold(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	large := strings.Repeat("large ", 10)
+	a.Store(TextPlain("/small", "small"))
+	a.Store(TextPlain("/large", large))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			if err := a.Store(TextPlain(fmt.Sprintf("/concurrent/%d", i), "data")); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	dst := filepath.Join(dir, "backup.db")
+	if err := a.Backup(dst); err != nil {
+		t.Fatalf("expected backup to succeed: %s", err)
+	}
+	<-done
+
+	b, err := Open(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	for id, want := range map[string]string{"/small": "small", "/large": large} {
+		if r, err := b.Load(id); err != nil || string(r.Data) != want {
+			t.Fatalf("expected backup to contain %s: %q %v", id, r.Data, err)
+		}
+	}
+	n, _ := b.CountWithPrefix("/concurrent/")
+	if got, want := b.Revision(), 2+n; got != want {
+		t.Fatalf("expected a consistent snapshot at revision %d but got %d", want, got)
+	}
+	if r, err := b.Audit(); err != nil || len(r.Discrepancies) != 0 {
+		t.Fatalf("expected a valid backup: %v %v", r.Discrepancies, err)
+	}
+}
+
+func TestWithSingleConnection(t *testing.T) {
+	a, err := Open(filepath.Join(t.TempDir(), "archive.db"), WithSingleConnection())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	errs := make(chan error, 16)
+	for w := 0; w < 16; w++ {
+		go func(w int) {
+			for i := 0; i < 50; i++ {
+				id := fmt.Sprintf("/%d/%d", w, i%5)
+				if err := a.Store(TextPlain(id, id)); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := a.Load(id); err != nil {
+					errs <- err
+					return
+				}
+				if _, err := a.ListWithPrefix(fmt.Sprintf("/%d/", w)); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}(w)
+	}
+	for w := 0; w < 16; w++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("expected concurrent access to succeed: %s", err)
+		}
+	}
+}
+
+func TestImportReader(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		data        string
+		typ         string
+	}{
+		{name: "typed", contentType: TypeTextCSV, data: "a,b\n1,2\n", typ: TypeTextCSV + "; charset=utf-8"},
+		{name: "sniffed", contentType: "", data: "<html><body>hi</body></html>", typ: "text/html; charset=utf-8"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := "/" + test.name
+			if err := a.ImportReader(id, test.contentType, strings.NewReader(test.data)); err != nil {
+				t.Fatalf("expected import to succeed: %s", err)
+			}
+			res, err := a.Load(id)
+			if err != nil {
+				t.Fatalf("expected load to succeed: %s", err)
+			}
+			if string(res.Data) != test.data {
+				t.Fatalf("expected %q but got %q", test.data, res.Data)
+			}
+			if got := res.Attributes[AttributeType]; got != test.typ {
+				t.Fatalf("expected type %q but got %q", test.typ, got)
+			}
+			if got, want := res.Attributes[AttributeChecksum], Checksum([]byte(test.data)); got != want {
+				t.Fatalf("expected checksum %q but got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestDB(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "a"))
+	a.Store(TextPlain("/b", "bb"))
+	var n, size int
+	if err := a.DB().QueryRow(`SELECT COUNT(*), SUM(SIZE) FROM RESOURCES;`).Scan(&n, &size); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || size != 3 {
+		t.Fatalf("expected %d resources of %d bytes but got %d of %d", 2, 3, n, size)
+	}
+}
+
+func TestDeleteByAttribute(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(MakeResource("/a", Attributes{AttributeLabel: "temp"}, nil))
+	a.Store(MakeResource("/b", Attributes{AttributeLabel: "keep"}, nil))
+	a.Store(MakeResource("/c", Attributes{AttributeLabel: "temp"}, nil))
+	a.Store(MakeResource("/d", Attributes{}, nil))
+	rev := a.Revision()
+
+	n, err := a.DeleteByAttribute(AttributeLabel, "temp")
+	if err != nil {
+		t.Fatalf("expected delete to succeed: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected %d deleted resources but got %d", 2, n)
+	}
+	if got := a.Revision(); got != rev+1 {
+		t.Fatalf("expected revision %d but got %d", rev+1, got)
+	}
+	ds, _ := a.List()
+	var ids []string
+	for _, d := range ds {
+		ids = append(ids, d.ID)
+	}
+	if want := []string{"/b", "/d"}; !reflect.DeepEqual(want, ids) {
+		t.Fatalf("expected %v to remain but got %v", want, ids)
+	}
+}
+
+func TestDeleteByAttributeQueuedMirroredAndWatched(t *testing.T) {
+	secondary, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secondary.Close()
+	a, err := Open(":memory:", WithAsyncWrites(10, nil), WithMirror(secondary, MirrorStrict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	events, unwatch := a.Watch()
+	defer unwatch()
+	a.Store(MakeResource("/a", Attributes{AttributeLabel: "temp"}, nil))
+	a.Store(MakeResource("/b", Attributes{AttributeLabel: "temp"}, nil))
+	n, err := a.DeleteByAttribute(AttributeLabel, "temp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected the queued resources to be deleted but got %d", n)
+	}
+	for _, x := range []*Archive{a, secondary} {
+		if c, _ := x.Count(); c != 0 {
+			t.Fatalf("expected no resources but got %d", c)
+		}
+	}
+	var deleted []string
+	for len(deleted) < 2 {
+		if e := <-events; e.Kind == EventDeleted {
+			deleted = append(deleted, e.ID)
+		}
+	}
+	if want := []string{"/a", "/b"}; !reflect.DeepEqual(want, deleted) {
+		t.Fatalf("expected %v to be deleted but got %v", want, deleted)
+	}
+}
+
+func TestListWithPrefixEscapesWildcards(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, id := range []string{"/report_2024/a", "/reportX2024/b", "/100%/c", "/1000/d", `/back\slash/e`, "/backXslash/f"} {
+		a.Store(TextPlain(id, id))
+	}
+	tests := []struct {
+		prefix string
+		ids    []string
+	}{
+		{prefix: "/report_2024", ids: []string{"/report_2024/a"}},
+		{prefix: "/100%", ids: []string{"/100%/c"}},
+		{prefix: `/back\`, ids: []string{`/back\slash/e`}},
+	}
+	for _, test := range tests {
+		t.Run(test.prefix, func(t *testing.T) {
+			ds, err := a.ListWithPrefix(test.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, d := range ds {
+				ids = append(ids, d.ID)
+			}
+			if !reflect.DeepEqual(test.ids, ids) {
+				t.Fatalf("expected %v but got %v", test.ids, ids)
+			}
+			if n, _ := a.CountWithPrefix(test.prefix); n != len(test.ids) {
+				t.Fatalf("expected count %d but got %d", len(test.ids), n)
+			}
+		})
+	}
+}
+
+func TestDeleteWithPrefix(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, id := range []string{"/users/42/a", "/users/42/b", "/users/420/c", "/users/4_/d", "/users/4%/e", "/USERS/42/f"} {
+		a.Store(TextPlain(id, id))
+	}
+	rev := a.Revision()
+
+	n, err := a.DeleteWithPrefix("/users/42/")
+	if err != nil {
+		t.Fatalf("expected delete to succeed: %s", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected %d deleted resources but got %d", 2, n)
+	}
+	if got := a.Revision(); got != rev+1 {
+		t.Fatalf("expected revision %d but got %d", rev+1, got)
+	}
+	if n, _ := a.DeleteWithPrefix("/users/4_/"); n != 1 {
+		t.Fatalf("expected %d deleted resources but got %d", 1, n)
+	}
+	if n, _ := a.DeleteWithPrefix("/users/4%"); n != 1 {
+		t.Fatalf("expected %d deleted resources but got %d", 1, n)
+	}
+	rev = a.Revision()
+	if n, _ := a.DeleteWithPrefix("/none/"); n != 0 || a.Revision() != rev {
+		t.Fatalf("expected nothing deleted and revision %d but got %d and %d", rev, n, a.Revision())
+	}
+	ds, _ := a.List()
+	var ids []string
+	for _, d := range ds {
+		ids = append(ids, d.ID)
+	}
+	if want := []string{"/USERS/42/f", "/users/420/c"}; !reflect.DeepEqual(want, ids) {
+		t.Fatalf("expected %v to remain but got %v", want, ids)
+	}
+}
+
+func TestListByAttribute(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/typed", "typed"))
+	a.Store(MakeResource("/untyped", Attributes{AttributeLabel: "x"}, nil))
+	a.Store(MakeResource("/empty", Attributes{}, nil))
+
+	ids := func(ds []Descriptor) []string {
+		res := []string{}
+		for _, d := range ds {
+			res = append(res, d.ID)
+		}
+		return res
+	}
+	ds, err := a.ListMissingAttribute(AttributeType)
+	if err != nil {
+		t.Fatalf("expected list to succeed: %s", err)
+	}
+	if want := []string{"/empty", "/untyped"}; !reflect.DeepEqual(want, ids(ds)) {
+		t.Fatalf("expected %v but got %v", want, ids(ds))
+	}
+	ds, _ = a.ListByAttribute(AttributeType, TypeTextPlain)
+	if want := []string{"/typed"}; !reflect.DeepEqual(want, ids(ds)) {
+		t.Fatalf("expected %v but got %v", want, ids(ds))
+	}
+}
+
+func TestImportFileIfChanged(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	file := filepath.Join(t.TempDir(), "notes.txt")
+	ioutil.WriteFile(file, []byte("v1"), 0644)
+	tests := []struct {
+		name     string
+		data     string
+		changed  bool
+		revision int
+	}{
+		{name: "new", data: "v1", changed: true, revision: 1},
+		{name: "identical", data: "v1", changed: false, revision: 1},
+		{name: "modified", data: "v2", changed: true, revision: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ioutil.WriteFile(file, []byte(test.data), 0644)
+			changed, err := a.ImportFileIfChanged("/notes", file)
+			if err != nil {
+				t.Fatalf("expected import to succeed: %s", err)
+			}
+			if changed != test.changed {
+				t.Fatalf("expected changed to be %v", test.changed)
+			}
+			if got := a.Revision(); got != test.revision {
+				t.Fatalf("expected revision %d but got %d", test.revision, got)
+			}
+			if r, _ := a.Load("/notes"); string(r.Data) != test.data {
+				t.Fatalf("expected %q but got %q", test.data, r.Data)
+			}
+		})
+	}
+}
+
+func TestImportFileIfChangedMirroredAndWatched(t *testing.T) {
+	secondary, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secondary.Close()
+	a, err := Open(":memory:", WithMirror(secondary, MirrorStrict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	events, unwatch := a.Watch()
+	defer unwatch()
+	file := filepath.Join(t.TempDir(), "notes.txt")
+	ioutil.WriteFile(file, []byte("v1"), 0644)
+	if changed, err := a.ImportFileIfChanged("/notes", file); err != nil || !changed {
+		t.Fatalf("expected the import to store the file: %v", err)
+	}
+	if r, err := secondary.Load("/notes"); err != nil || string(r.Data) != "v1" {
+		t.Fatalf("expected the import to be mirrored but got %v %v", r, err)
+	}
+	if e := <-events; e.ID != "/notes" || e.Kind != EventStored {
+		t.Fatalf("expected an event for /notes but got %v", e)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "alpha"))
+	a.Store(JPEG("/b", []byte("jpeg")))
+
+	ds, _ := a.List()
+	for _, want := range ds {
+		got, err := a.Describe(want.ID)
+		if err != nil {
+			t.Fatalf("expected describe to succeed: %s", err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("expected %v but got %v", want, got)
+		}
+	}
+	_, err = a.Describe("/missing")
+	if err != ErrNotFound {
+		t.Fatalf("expected %v but got %v", ErrNotFound, err)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected %v to match %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestReplaceSubtree(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/site/index.html", "old index"))
+	a.Store(TextPlain("/site/about.html", "old about"))
+	a.Store(TextPlain("/site/css/main.css", "old css"))
+	a.Store(TextPlain("/other", "untouched"))
+	rev := a.Revision()
+
+	err = a.ReplaceSubtree("/site/", []Resource{
+		TextPlain("/site/index.html", "new index"),
+		TextPlain("/site/news.html", "new news"),
+	})
+	if err != nil {
+		t.Fatalf("expected replace to succeed: %s", err)
+	}
+	if got := a.Revision(); got != rev+1 {
+		t.Fatalf("expected revision %d but got %d", rev+1, got)
+	}
+	ds, _ := a.List()
+	var ids []string
+	for _, d := range ds {
+		ids = append(ids, d.ID)
+	}
+	if want := []string{"/other", "/site/index.html", "/site/news.html"}; !reflect.DeepEqual(want, ids) {
+		t.Fatalf("expected %v but got %v", want, ids)
+	}
+	if res, _ := a.Load("/site/index.html"); string(res.Data) != "new index" {
+		t.Fatalf("expected %q but got %q", "new index", res.Data)
+	}
+
+	if err := a.ReplaceSubtree("/site/", []Resource{TextPlain("/elsewhere", "x")}); err == nil {
+		t.Fatalf("expected resources outside the prefix to be rejected")
+	}
+	if got := a.Revision(); got != rev+1 {
+		t.Fatalf("expected revision %d but got %d", rev+1, got)
+	}
+}
+
+func TestRawRow(t *testing.T) {
+	a, err := Open(":memory:", WithCompression(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/small", "tiny"))
+	a.Store(TextPlain("/large", strings.Repeat("compress me ", 100)))
+
+	for _, id := range []string{"/small", "/large"} {
+		stored, err := a.loadStored(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		text, n, enc, err := a.RawRow(id)
+		if err != nil {
+			t.Fatalf("expected raw row of %s: %s", id, err)
+		}
+		if want := stored.Attributes.String(); text != want {
+			t.Fatalf("expected %q but got %q", want, text)
+		}
+		if n != int64(len(stored.Data)) {
+			t.Fatalf("expected %d stored bytes but got %d", len(stored.Data), n)
+		}
+		if want := stored.Attributes[AttributeEncoding]; enc != want {
+			t.Fatalf("expected encoding %q but got %q", want, enc)
+		}
+	}
+	if _, _, enc, _ := a.RawRow("/large"); enc != EncodingGZIP {
+		t.Fatalf("expected encoding %q but got %q", EncodingGZIP, enc)
+	}
+	if _, _, _, err := a.RawRow("/missing"); err != sql.ErrNoRows {
+		t.Fatalf("expected %v but got %v", sql.ErrNoRows, err)
+	}
+}
+
+func TestContextCancellation(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "alpha"))
+	rev := a.Revision()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"store", func() error { return a.StoreContext(ctx, TextPlain("/b", "beta")) }},
+		{"load", func() error { _, err := a.LoadContext(ctx, "/a"); return err }},
+		{"list", func() error { _, err := a.ListContext(ctx); return err }},
+		{"list with prefix", func() error { _, err := a.ListWithPrefixContext(ctx, "/"); return err }},
+		{"delete", func() error { return a.DeleteContext(ctx, "/a") }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.call(); err != context.Canceled {
+				t.Fatalf("expected %v but got %v", context.Canceled, err)
+			}
+		})
+	}
+	if got := a.Revision(); got != rev {
+		t.Fatalf("expected revision %d but got %d", rev, got)
+	}
+	ds, _ := a.ListContext(context.Background())
+	if len(ds) != 1 || ds[0].ID != "/a" {
+		t.Fatalf("expected only %s to exist but got %v", "/a", ds)
+	}
+}
+
+func TestCountAndExists(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a/1", "one"))
+	a.Store(TextPlain("/a/2", "two"))
+	a.Store(TextPlain("/b/1", "three"))
+
+	if n, err := a.Count(); err != nil || n != 3 {
+		t.Fatalf("expected %d resources but got %d, %v", 3, n, err)
+	}
+	tests := []struct {
+		prefix string
+		n      int
+	}{
+		{"/a/", 2},
+		{"/b/", 1},
+		{"/c/", 0},
+		{"", 3},
+	}
+	for _, test := range tests {
+		if n, err := a.CountWithPrefix(test.prefix); err != nil || n != test.n {
+			t.Fatalf("expected %d resources below %q but got %d, %v", test.n, test.prefix, n, err)
+		}
+	}
+	if ok, err := a.Exists("/a/1"); err != nil || !ok {
+		t.Fatalf("expected %s to exist but got %v, %v", "/a/1", ok, err)
+	}
+	if ok, err := a.Exists("/a"); err != nil || ok {
+		t.Fatalf("expected %s not to exist but got %v, %v", "/a", ok, err)
+	}
+}
+
+func TestStoreBatch(t *testing.T) {
+	a, err := Open(":memory:", WithAllowedTypes(TypeTextPlain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	var rs []Resource
+	for i := 0; i < 100; i++ {
+		rs = append(rs, TextPlain(fmt.Sprintf("/%03d", i), fmt.Sprintf("resource %d", i)))
+	}
+	if err := a.StoreBatch(rs); err != nil {
+		t.Fatalf("expected batch to succeed: %s", err)
+	}
+	if got := a.Revision(); got != 1 {
+		t.Fatalf("expected revision %d but got %d", 1, got)
+	}
+	res, _ := a.Load("/042")
+	if res.Attributes[AttributeLength] != "11" || !res.Attributes.Has(AttributeLastModified) {
+		t.Fatalf("expected length and last modified to be set but got %v", res.Attributes)
+	}
+
+	err = a.StoreBatch([]Resource{TextPlain("/new", "ok"), JPEG("/bad", []byte("jpeg"))})
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected %v but got %v", ErrUnsupportedType, err)
+	}
+	if ok, _ := a.Exists("/new"); ok {
+		t.Fatalf("expected the failed batch to be rolled back")
+	}
+	if got := a.Revision(); got != 1 {
+		t.Fatalf("expected revision %d but got %d", 1, got)
+	}
+}
@@ -0,0 +1,18 @@
+package archive
+
+import "fmt"
+
+// checkAttributesSize enforces the limit of WithMaxAttributesSize.
+func (a *Archive) checkAttributesSize(id string, as Attributes) error {
+	if a.maxAttributesSize <= 0 {
+		return nil
+	}
+	size := 0
+	for k, v := range as {
+		size += len(k) + len(v)
+	}
+	if size > a.maxAttributesSize {
+		return fmt.Errorf("%w: %s has %d bytes of attributes, the limit is %d", ErrAttributesTooLarge, id, size, a.maxAttributesSize)
+	}
+	return nil
+}
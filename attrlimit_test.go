@@ -0,0 +1,36 @@
+package archive
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithMaxAttributesSize(t *testing.T) {
+	a, err := Open(":memory:", WithMaxAttributesSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	tests := []struct {
+		name  string
+		label string
+		err   error
+	}{
+		{name: "under", label: "short"},
+		{name: "over", label: strings.Repeat("x", 256), err: ErrAttributesTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := "/" + test.name
+			err := a.Store(MakeResource(id, Attributes{AttributeLabel: test.label}, []byte("data")))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v but got %v", test.err, err)
+			}
+			if _, err := a.Attributes(id); (err == nil) != (test.err == nil) {
+				t.Fatalf("expected resource to be stored only if under the limit: %v", err)
+			}
+		})
+	}
+}
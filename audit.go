@@ -0,0 +1,147 @@
+package archive
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+)
+
+type Report struct {
+	Discrepancies []Discrepancy
+}
+
+func (r Report) OK() bool {
+	return len(r.Discrepancies) == 0
+}
+
+type Discrepancy struct {
+	ID      string
+	Problem string
+}
+
+func (d Discrepancy) String() string {
+	return d.ID + ": " + d.Problem
+}
+
+// Audit cross-checks the invariants the archive maintains and reports every
+// violation found: the data of every resource against its attributes and
+// SIZE column, the revision against the history and the change log, edges
+// against their resources and data files against the resources referring to
+// them. It only reads and is safe to run at any time.
+func (a *Archive) Audit() (Report, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	r := Report{}
+	add := func(id, format string, args ...interface{}) {
+		r.Discrepancies = append(r.Discrepancies, Discrepancy{ID: id, Problem: fmt.Sprintf(format, args...)})
+	}
+	err := transact(ctx, a.db, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT ID, ATTRIBUTES, DATA, SIZE, EXTERNAL FROM RESOURCES ORDER BY ID;`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id, attributes string
+			var data []byte
+			var size sql.NullInt64
+			var external sql.NullString
+			if err := rows.Scan(&id, &attributes, &data, &size, &external); err != nil {
+				return err
+			}
+			if data, err = a.fetch(data, external); err != nil {
+				add(id, "data cannot be read: %v", err)
+				continue
+			}
+			as, err := ParseAttributes(attributes)
+			if err != nil {
+				return err
+			}
+			if data, err = decode(as, data); err != nil {
+				add(id, "data cannot be decoded: %v", err)
+				continue
+			}
+			if l, ok := as[AttributeLength]; !ok {
+				add(id, "missing %s attribute", AttributeLength)
+			} else if n, err := strconv.Atoi(l); err != nil || n != len(data) {
+				add(id, "%s attribute is %q but data has %d bytes", AttributeLength, l, len(data))
+			}
+			if _, ok := tiered(external); ok {
+				// the size of tiered data counts against the cold archive
+			} else if !size.Valid || size.Int64 != int64(len(data)) {
+				add(id, "size column is %v but data has %d bytes", size.Int64, len(data))
+			}
+			if sum, ok := as[AttributeChecksum]; ok && sum != Checksum(data) {
+				add(id, "%s attribute is %q but data has %s", AttributeChecksum, sum, Checksum(data))
+			}
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows.Close()
+
+		var revision, maxHistory int
+		if err := tx.QueryRowContext(ctx, `SELECT VALUE FROM INFO WHERE NAME = ?;`, InfoRevision).Scan(&revision); err != nil {
+			return err
+		}
+		if err := tx.QueryRowContext(ctx, `SELECT IFNULL(MAX(REVISION), 0) FROM HISTORY;`).Scan(&maxHistory); err != nil {
+			return err
+		}
+		if maxHistory > revision {
+			add("", "revision is %d but history records revision %d", revision, maxHistory)
+		}
+		// the change log may be compacted entirely, but what is left of it
+		// ends at the current revision
+		var lastChange sql.NullInt64
+		if err := tx.QueryRowContext(ctx, `SELECT MAX(REVISION) FROM CHANGES;`).Scan(&lastChange); err != nil {
+			return err
+		}
+		if lastChange.Valid && int(lastChange.Int64) != revision {
+			add("", "revision is %d but the change log ends at revision %d", revision, lastChange.Int64)
+		}
+
+		edges, err := tx.QueryContext(ctx, `SELECT FROM_ID, TO_ID, REL FROM EDGES WHERE FROM_ID NOT IN (SELECT ID FROM RESOURCES) OR TO_ID NOT IN (SELECT ID FROM RESOURCES) ORDER BY FROM_ID, REL, TO_ID;`)
+		if err != nil {
+			return err
+		}
+		defer edges.Close()
+		for edges.Next() {
+			var from, to, rel string
+			if err := edges.Scan(&from, &to, &rel); err != nil {
+				return err
+			}
+			add(from, "orphaned %q edge to %s", rel, to)
+		}
+		if err := edges.Err(); err != nil {
+			return err
+		}
+		edges.Close()
+
+		if a.blobs == "" {
+			return nil
+		}
+		infos, err := ioutil.ReadDir(a.blobs)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		used, err := usedBlobs(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			if !used[info.Name()] {
+				add("", "data file %s is not referred to by any resource; Vacuum removes it", info.Name())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, a.translate(ctx, err)
+	}
+	return r, nil
+}
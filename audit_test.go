@@ -0,0 +1,78 @@
+package archive
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, id := range []string{"/a", "/b", "/c", "/d"} {
+		a.Store(TextPlain(id, "content of "+id))
+	}
+	a.AddEdge("/a", "/b", "link")
+
+	r, err := a.Audit()
+	if err != nil {
+		t.Fatalf("expected audit to succeed: %s", err)
+	}
+	if !r.OK() {
+		t.Fatalf("expected consistent archive but got %v", r.Discrepancies)
+	}
+
+	a.db.Exec(`UPDATE RESOURCES SET DATA = ? WHERE ID = ?;`, []byte("tampered     "), "/b")
+	a.db.Exec(`UPDATE RESOURCES SET SIZE = 0 WHERE ID = ?;`, "/c")
+	a.db.Exec(`INSERT INTO EDGES (FROM_ID, TO_ID, REL) VALUES (?, ?, ?);`, "/d", "/gone", "link")
+
+	r, err = a.Audit()
+	if err != nil {
+		t.Fatalf("expected audit to succeed: %s", err)
+	}
+	got := map[string]int{}
+	for _, d := range r.Discrepancies {
+		got[d.ID]++
+	}
+	want := map[string]int{"/b": 1, "/c": 1, "/d": 1}
+	if len(got) != len(want) {
+		t.Fatalf("expected discrepancies for %v but got %v", want, r.Discrepancies)
+	}
+	for id, n := range want {
+		if got[id] != n {
+			t.Errorf("expected %d discrepancy for %s but got %d: %v", n, id, got[id], r.Discrepancies)
+		}
+	}
+}
+
+func TestAuditChangesAndDataFiles(t *testing.T) {
+	a, err := Open(filepath.Join(t.TempDir(), "archive.db"), WithInlineThreshold(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/large", "large data"))
+	a.Delete("/large")
+	r, err := a.Audit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Discrepancies) != 1 {
+		t.Fatalf("expected the unreferenced data file to be reported but got %v", r.Discrepancies)
+	}
+	if err := a.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := a.Audit(); !r.OK() {
+		t.Fatalf("expected consistent archive after vacuum but got %v", r.Discrepancies)
+	}
+
+	a.db.Exec(`UPDATE INFO SET VALUE = VALUE + 1 WHERE NAME = ?;`, InfoRevision)
+	if r, _ := a.Audit(); len(r.Discrepancies) != 1 {
+		t.Fatalf("expected the change log to be reported but got %v", r.Discrepancies)
+	}
+}
@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// MarshalBinary encodes the resource as
+//
+//	idLen uint32, id,
+//	count uint32, count times keyLen uint32, key, valueLen uint32, value,
+//	dataLen int64 (-1 for no data), data
+//
+// with all integers big-endian and the attributes sorted by key.
+func (r Resource) MarshalBinary() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writePackString(buf, r.ID)
+	es := r.Attributes.Entries()
+	binary.Write(buf, binary.BigEndian, uint32(len(es)))
+	for _, e := range es {
+		writePackString(buf, e.Key)
+		writePackString(buf, e.Value)
+	}
+	if r.Data == nil {
+		binary.Write(buf, binary.BigEndian, int64(-1))
+	} else {
+		binary.Write(buf, binary.BigEndian, int64(len(r.Data)))
+		buf.Write(r.Data)
+	}
+	return buf.Bytes(), nil
+}
+
+var errInvalidBinary = errors.New("archive: invalid binary resource")
+
+func (r *Resource) UnmarshalBinary(data []byte) error {
+	d := binaryDecoder{data: data}
+	id := d.string()
+	n := d.uint32()
+	as := Attributes{}
+	for i := uint32(0); i < n && d.err == nil; i++ {
+		k := d.string()
+		as[k] = d.string()
+	}
+	var bs []byte
+	if l := int64(d.uint64()); l >= 0 {
+		bs = append([]byte{}, d.bytes(l)...)
+	}
+	if d.err == nil && len(d.data) > 0 {
+		d.err = errInvalidBinary
+	}
+	if d.err != nil {
+		return d.err
+	}
+	*r = Resource{ID: id, Attributes: as, Data: bs}
+	return nil
+}
+
+// binaryDecoder reads the fields of a binary resource, recording the first
+// error and returning zero values after it.
+type binaryDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *binaryDecoder) bytes(n int64) []byte {
+	if d.err != nil || n < 0 || n > int64(len(d.data)) {
+		d.err = errInvalidBinary
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *binaryDecoder) uint32() uint32 {
+	if b := d.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *binaryDecoder) uint64() uint64 {
+	if b := d.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *binaryDecoder) string() string {
+	return string(d.bytes(int64(d.uint32())))
+}
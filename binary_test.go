@@ -0,0 +1,35 @@
+package archive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourceBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		res  Resource
+	}{
+		{name: "binary", res: MakeResource("/bin", Attributes{AttributeType: "application/octet-stream", "Note": "a: b\r\nc"}, []byte("line\n\x00\r\nnull\x00"))},
+		{name: "empty", res: MakeResource("/empty", Attributes{}, []byte{})},
+		{name: "nil", res: MakeResource("/nil", Attributes{AttributeLabel: ""}, nil)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bs, err := test.res.MarshalBinary()
+			if err != nil {
+				t.Fatalf("expected marshal to succeed: %s", err)
+			}
+			var got Resource
+			if err := got.UnmarshalBinary(bs); err != nil {
+				t.Fatalf("expected unmarshal to succeed: %s", err)
+			}
+			if !reflect.DeepEqual(test.res, got) {
+				t.Fatalf("expected %#v but got %#v", test.res, got)
+			}
+			if err := got.UnmarshalBinary(bs[:len(bs)-1]); err == nil {
+				t.Fatalf("expected truncated input to fail")
+			}
+		})
+	}
+}
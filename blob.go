@@ -0,0 +1,252 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Data stored larger than the threshold of WithInlineThreshold is kept in
+// files in a directory next to the database rather than in the DATA column.
+// The files are named after the checksum of their content, and the EXTERNAL
+// column holds the name. Files no longer referenced are removed when the
+// archive is opened.
+
+// blobDir returns the directory of the external data files, or "" for
+// in-memory archives, which keep all data inline.
+func blobDir(dsn string) string {
+	if isMemory(dsn) {
+		return ""
+	}
+	path := strings.TrimPrefix(dsn, "file:")
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	if path == "" {
+		return ""
+	}
+	return path + ".blobs"
+}
+
+// externalize moves stored data above the inline threshold to a file. It
+// returns the data to keep in the DATA column and the value of the EXTERNAL
+// column.
+func (a *Archive) externalize(stored []byte) ([]byte, sql.NullString, error) {
+	if a.inlineThreshold <= 0 || a.blobs == "" || int64(len(stored)) <= a.inlineThreshold {
+		return stored, sql.NullString{}, nil
+	}
+	_, name := splitChecksum(Checksum(stored))
+	path := filepath.Join(a.blobs, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(a.blobs, 0755); err != nil {
+			return nil, sql.NullString{}, err
+		}
+		f, err := ioutil.TempFile(a.blobs, ".tmp-")
+		if err != nil {
+			return nil, sql.NullString{}, err
+		}
+		_, err = f.Write(stored)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), path)
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return nil, sql.NullString{}, err
+		}
+	} else if err != nil {
+		return nil, sql.NullString{}, err
+	}
+	return nil, sql.NullString{String: name, Valid: true}, nil
+}
+
+// fetch returns the stored data of a resource given its DATA and EXTERNAL
+// columns.
+func (a *Archive) fetch(data []byte, external sql.NullString) ([]byte, error) {
+	if !external.Valid {
+		return a.open(data)
+	}
+	if id, ok := tiered(external); ok {
+		return a.fetchCold(id)
+	}
+	sealed, err := ioutil.ReadFile(filepath.Join(a.blobs, external.String))
+	if err != nil {
+		return nil, err
+	}
+	return a.open(sealed)
+}
+
+// externalSize returns the length of the stored data kept outside the
+// DATA column.
+func (a *Archive) externalSize(external sql.NullString) (int64, error) {
+	if _, ok := tiered(external); ok {
+		data, err := a.fetch(nil, external)
+		return int64(len(data)), err
+	}
+	info, err := os.Stat(filepath.Join(a.blobs, external.String))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// relocate moves the data of the resources to where the inline threshold
+// says it belongs and removes unreferenced data files.
+func (a *Archive) relocate(ctx context.Context, db *sql.DB) error {
+	if a.blobs == "" {
+		return nil
+	}
+	err := transact(ctx, db, func(tx *sql.Tx) error {
+		if err := a.inline(ctx, tx); err != nil {
+			return err
+		}
+		if a.inlineThreshold <= 0 {
+			return nil
+		}
+		// collect the IDs first, so that RESOURCES is not updated under the
+		// cursor
+		rows, err := tx.QueryContext(ctx, `SELECT ID FROM RESOURCES WHERE EXTERNAL IS NULL AND LENGTH(CAST(DATA AS BLOB)) > ?;`, a.inlineThreshold)
+		if err != nil {
+			return err
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			var data []byte
+			if err := tx.QueryRowContext(ctx, `SELECT DATA FROM RESOURCES WHERE ID = ?;`, id).Scan(&data); err != nil {
+				return err
+			}
+			data, external, err := a.externalize(data)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE RESOURCES SET DATA = ?, EXTERNAL = ? WHERE ID = ?;`, data, external, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return a.collectBlobs(ctx, db)
+}
+
+// inline moves external data at or below the inline threshold back into the
+// DATA column.
+func (a *Archive) inline(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `SELECT ID, EXTERNAL FROM RESOURCES WHERE EXTERNAL IS NOT NULL AND EXTERNAL NOT LIKE ?;`, tierPrefix+"%")
+	if err != nil {
+		return err
+	}
+	moved := map[string]string{}
+	for rows.Next() {
+		var id, name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return err
+		}
+		info, err := os.Stat(filepath.Join(a.blobs, name))
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if a.inlineThreshold <= 0 || info.Size() <= a.inlineThreshold {
+			moved[id] = name
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, name := range moved {
+		data, err := ioutil.ReadFile(filepath.Join(a.blobs, name))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE RESOURCES SET DATA = ?, EXTERNAL = NULL WHERE ID = ?;`, data, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// usedBlobs returns the names of the data files resources refer to.
+func usedBlobs(ctx context.Context, q querier) (map[string]bool, error) {
+	rows, err := q.QueryContext(ctx, `SELECT DISTINCT EXTERNAL FROM RESOURCES WHERE EXTERNAL IS NOT NULL AND EXTERNAL NOT LIKE ?;`, tierPrefix+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	used := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		used[name] = true
+	}
+	return used, rows.Err()
+}
+
+// removeBlob removes the data file name unless a resource still refers to it.
+func (a *Archive) removeBlob(name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ctx, cancel := a.context()
+	defer cancel()
+	var used bool
+	if err := a.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM RESOURCES WHERE EXTERNAL = ?);`, name).Scan(&used); err != nil {
+		return a.translate(ctx, err)
+	}
+	if used {
+		return nil
+	}
+	if err := os.Remove(filepath.Join(a.blobs, name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// collectBlobs removes the data files no resource refers to.
+func (a *Archive) collectBlobs(ctx context.Context, db *sql.DB) error {
+	infos, err := ioutil.ReadDir(a.blobs)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	used, err := usedBlobs(ctx, db)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if !used[info.Name()] {
+			if err := os.Remove(filepath.Join(a.blobs, info.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
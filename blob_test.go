@@ -0,0 +1,106 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInlineThreshold(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	a, err := Open(file, WithInlineThreshold(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	small := "small"
+	large := strings.Repeat("large ", 10)
+	a.Store(TextPlain("/small", small))
+	a.Store(TextPlain("/exact", strings.Repeat("x", 16)))
+	a.Store(TextPlain("/large", large))
+
+	external := func(a *Archive) []string {
+		rows, err := a.db.Query(`SELECT ID FROM RESOURCES WHERE EXTERNAL IS NOT NULL ORDER BY ID;`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		ids := []string{}
+		for rows.Next() {
+			var id string
+			rows.Scan(&id)
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	blobs := func() int {
+		infos, _ := ioutil.ReadDir(file + ".blobs")
+		return len(infos)
+	}
+	if got := external(a); len(got) != 1 || got[0] != "/large" {
+		t.Fatalf("expected only %s to be stored externally but got %v", "/large", got)
+	}
+	for id, want := range map[string]string{"/small": small, "/large": large} {
+		res, err := a.Load(id)
+		if err != nil || string(res.Data) != want {
+			t.Fatalf("expected %q for %s but got %q, %v", want, id, res.Data, err)
+		}
+		r, _, err := a.LoadStream(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(r)
+		r.Close()
+		if string(data) != want {
+			t.Fatalf("expected to stream %q for %s but got %q", want, id, data)
+		}
+		if err := a.Verify(id); err != nil {
+			t.Fatalf("expected %s to verify: %s", id, err)
+		}
+	}
+	if r, _ := a.Audit(); !r.OK() {
+		t.Fatalf("expected archive to pass audit: %v", r.Discrepancies)
+	}
+	buf := &bytes.Buffer{}
+	if err := a.ExportPack(buf, ExportVerify()); err != nil {
+		t.Fatalf("expected export to succeed: %s", err)
+	}
+	c, err := a.CloneToMemory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := c.Load("/large"); err != nil || string(res.Data) != large {
+		t.Fatalf("expected the clone to load %s but got %q, %v", "/large", res.Data, err)
+	}
+	c.Close()
+	a.Delete("/large")
+	a.Close()
+
+	a, err = Open(file, WithInlineThreshold(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := external(a); len(got) != 2 || got[0] != "/exact" || got[1] != "/small" {
+		t.Fatalf("expected %v to be moved out but got %v", []string{"/exact", "/small"}, got)
+	}
+	if n := blobs(); n != 2 {
+		t.Fatalf("expected %d data files but got %d", 2, n)
+	}
+	a.Close()
+
+	a, err = Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	if got := external(a); len(got) != 0 {
+		t.Fatalf("expected all data to be moved back but got %v", got)
+	}
+	if n := blobs(); n != 0 {
+		t.Fatalf("expected no data files but got %d", n)
+	}
+	if res, _ := a.Load("/small"); string(res.Data) != small {
+		t.Fatalf("expected %q but got %q", small, res.Data)
+	}
+}
@@ -0,0 +1,47 @@
+//go:build cgo
+// +build cgo
+
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+const cgoEnabled = true
+
+// backup copies the main database of src into dst using SQLite's online
+// backup API.
+func backup(ctx context.Context, dst, src *sql.DB) error {
+	dconn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dconn.Close()
+	sconn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer sconn.Close()
+	return dconn.Raw(func(d interface{}) error {
+		return sconn.Raw(func(s interface{}) error {
+			dc, ok := d.(*sqlite3.SQLiteConn)
+			sc, ok2 := s.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return fmt.Errorf("%w: %T does not support the backup API", ErrDriverUnavailable, s)
+			}
+			b, err := dc.Backup("main", sc, "main")
+			if err != nil {
+				return err
+			}
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
@@ -0,0 +1,94 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+)
+
+// The CHANGES table logs which resources were stored or deleted at which
+// revision. An entry is recorded with the revision the surrounding
+// transaction bumps the archive to, and a later change of the same resource
+// within that transaction replaces the earlier one.
+
+const (
+	changeStored  = "STORED"
+	changeDeleted = "DELETED"
+)
+
+func recordChange(ctx context.Context, tx *sql.Tx, id, op string) error {
+	_, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO CHANGES (REVISION, ID, OP) SELECT VALUE + 1, ?, ? FROM INFO WHERE NAME = ?;`, id, op, InfoRevision)
+	return err
+}
+
+// Change is an entry of the change log: the resource ID was stored or
+// deleted, as told by Kind, at Revision.
+type Change struct {
+	Revision int
+	ID       string
+	Kind     EventKind
+}
+
+// Changes returns the entries of the change log after revision since, ordered
+// by revision and ID, so a client synced at revision since can catch up by
+// applying them. Only the last change of a resource within a revision is
+// logged, and entries removed by CompactChanges are gone.
+func (a *Archive) Changes(since int) ([]Change, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	rows, err := a.db.QueryContext(ctx, `SELECT REVISION, ID, OP FROM CHANGES WHERE REVISION > ? ORDER BY REVISION, ID;`, since)
+	if err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	cs, err := scanChanges(rows)
+	if err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	return cs, nil
+}
+
+// changedSince returns the changes tx logged after revision, in the order
+// they were made.
+func changedSince(ctx context.Context, tx *sql.Tx, revision int) ([]Change, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT REVISION, ID, OP FROM CHANGES WHERE REVISION > ? ORDER BY ROWID;`, revision)
+	if err != nil {
+		return nil, err
+	}
+	return scanChanges(rows)
+}
+
+func scanChanges(rows *sql.Rows) ([]Change, error) {
+	defer rows.Close()
+	var cs []Change
+	for rows.Next() {
+		var c Change
+		var op string
+		if err := rows.Scan(&c.Revision, &c.ID, &op); err != nil {
+			return nil, err
+		}
+		c.Kind = EventStored
+		if op == changeDeleted {
+			c.Kind = EventDeleted
+		}
+		cs = append(cs, c)
+	}
+	return cs, rows.Err()
+}
+
+// CompactChanges removes the entries of the change log up to and including
+// revision keepAfter and returns their number. Entries of later revisions
+// are kept, so clients synced at keepAfter or later can still catch up.
+func (a *Archive) CompactChanges(keepAfter int) (int, error) {
+	if err := a.writable(); err != nil {
+		return 0, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ctx, cancel := a.context()
+	defer cancel()
+	r, err := a.db.ExecContext(ctx, `DELETE FROM CHANGES WHERE REVISION <= ?;`, keepAfter)
+	if err != nil {
+		return 0, a.translate(ctx, err)
+	}
+	n, err := r.RowsAffected()
+	return int(n), err
+}
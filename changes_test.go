@@ -0,0 +1,88 @@
+package archive
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestChanges(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "a"))
+	synced := a.Revision()
+	a.StoreBatch([]Resource{TextPlain("/c", "c"), TextPlain("/b", "b")})
+	a.Delete("/a")
+
+	cs, err := a.Changes(synced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Revision: synced + 1, ID: "/b", Kind: EventStored},
+		{Revision: synced + 1, ID: "/c", Kind: EventStored},
+		{Revision: synced + 2, ID: "/a", Kind: EventDeleted},
+	}
+	if !reflect.DeepEqual(want, cs) {
+		t.Fatalf("expected %v but got %v", want, cs)
+	}
+	if cs, _ := a.Changes(a.Revision()); len(cs) != 0 {
+		t.Fatalf("expected no changes but got %v", cs)
+	}
+}
+
+func TestCompactChanges(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for i := 0; i < 10; i++ {
+		a.Store(TextPlain(fmt.Sprintf("/%d", i), "data"))
+	}
+	a.Delete("/3")
+	a.Batch(func(b *Batch) error {
+		b.Store(TextPlain("/x", "first"))
+		b.Delete("/x")
+		return nil
+	})
+
+	entries := func() []string {
+		rows, err := a.db.Query(`SELECT REVISION, ID, OP FROM CHANGES ORDER BY REVISION, ID;`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var es []string
+		for rows.Next() {
+			var rev int
+			var id, op string
+			rows.Scan(&rev, &id, &op)
+			es = append(es, fmt.Sprintf("%d %s %s", rev, id, op))
+		}
+		return es
+	}
+	if got := len(entries()); got != 12 {
+		t.Fatalf("expected %d entries but got %d: %v", 12, got, entries())
+	}
+
+	n, err := a.CompactChanges(9)
+	if err != nil {
+		t.Fatalf("expected compaction to succeed: %s", err)
+	}
+	if n != 9 {
+		t.Fatalf("expected %d removed entries but got %d", 9, n)
+	}
+	want := []string{"10 /9 STORED", "11 /3 DELETED", "12 /x DELETED"}
+	if got := entries(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+	if n, _ := a.CompactChanges(9); n != 0 {
+		t.Fatalf("expected nothing left to compact but removed %d", n)
+	}
+}
@@ -0,0 +1,135 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// A Codec compresses data stored under an encoding.
+type Codec interface {
+	Encode(data []byte, level int) ([]byte, error)
+	Decode(stored []byte) ([]byte, error)
+}
+
+var codecs = struct {
+	sync.RWMutex
+	m map[string]Codec
+}{m: map[string]Codec{
+	EncodingBrotli: brotliCodec{},
+	EncodingGZIP:   gzipCodec{},
+}}
+
+// RegisterCodec makes a codec available for the given encoding, replacing
+// any codec registered for it before.
+func RegisterCodec(encoding string, c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.m[encoding] = c
+}
+
+func codec(encoding string) (Codec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, ok := codecs.m[encoding]
+	return c, ok
+}
+
+// encode prepares data for storage and records the chosen representation in
+// the Encoding attribute. With compression enabled, data is stored compressed
+// with the configured codec unless compressing does not make it smaller, in
+// which case it is stored as is and marked identity.
+func (a *Archive) encode(as Attributes, data []byte) ([]byte, error) {
+	delete(as, AttributeEncoding)
+	if !a.compress || data == nil {
+		return data, nil
+	}
+	enc := a.encoding
+	if enc == "" {
+		enc = EncodingGZIP
+	}
+	c, ok := codec(enc)
+	if !ok {
+		return nil, fmt.Errorf("archive: unsupported encoding %q", enc)
+	}
+	stored, err := c.Encode(data, a.compression)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored) >= len(data) {
+		as[AttributeEncoding] = EncodingIdentity
+		return data, nil
+	}
+	as[AttributeEncoding] = enc
+	return stored, nil
+}
+
+// decode restores the original data from its stored representation as
+// indicated by the Encoding attribute.
+func decode(as Attributes, stored []byte) ([]byte, error) {
+	enc := as[AttributeEncoding]
+	if enc == "" || enc == EncodingIdentity {
+		return stored, nil
+	}
+	c, ok := codec(enc)
+	if !ok {
+		return nil, fmt.Errorf("archive: unsupported encoding %q", enc)
+	}
+	data, err := c.Decode(stored)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, nil
+}
+
+type gzipCodec struct{}
+
+func (gzipCodec) Encode(data []byte, level int) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	zw, err := gzip.NewWriterLevel(buf, level)
+	if err != nil {
+		return nil, err
+	}
+	return compress(buf, zw, data)
+}
+
+func (gzipCodec) Decode(stored []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(stored))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
+
+type brotliCodec struct{}
+
+func (brotliCodec) Encode(data []byte, level int) ([]byte, error) {
+	if level < brotli.BestSpeed || level > brotli.BestCompression {
+		level = brotli.DefaultCompression
+	}
+	buf := &bytes.Buffer{}
+	return compress(buf, brotli.NewWriterLevel(buf, level), data)
+}
+
+func (brotliCodec) Decode(stored []byte) ([]byte, error) {
+	return ioutil.ReadAll(brotli.NewReader(bytes.NewReader(stored)))
+}
+
+func compress(buf *bytes.Buffer, w io.WriteCloser, data []byte) ([]byte, error) {
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
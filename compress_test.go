@@ -0,0 +1,160 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompressionOnlyWhenSmaller(t *testing.T) {
+	a, err := Open(":memory:", WithCompression(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("compress me "), 1000)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		encoding string
+	}{
+		{name: "incompressible", data: random, encoding: EncodingIdentity},
+		{name: "compressible", data: text, encoding: EncodingGZIP},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := "/" + test.name
+			if err := a.Store(MakeResource(id, Attributes{AttributeEncoding: "bogus"}, test.data)); err != nil {
+				t.Fatalf("expected store to succeed: %s", err)
+			}
+			var stored int
+			a.db.QueryRow(`SELECT LENGTH(DATA) FROM RESOURCES WHERE ID = ?;`, id).Scan(&stored)
+			if stored > len(test.data) {
+				t.Errorf("expected at most %d stored bytes but got %d", len(test.data), stored)
+			}
+			res, err := a.Load(id)
+			if err != nil {
+				t.Fatalf("expected load to succeed: %s", err)
+			}
+			if got := res.Attributes[AttributeEncoding]; got != test.encoding {
+				t.Errorf("expected encoding %q but got %q", test.encoding, got)
+			}
+			if !bytes.Equal(test.data, res.Data) {
+				t.Errorf("expected original data to be loaded")
+			}
+			if err := a.Verify(id); err != nil {
+				t.Errorf("expected verify to succeed: %s", err)
+			}
+		})
+	}
+	var stored int
+	a.db.QueryRow(`SELECT LENGTH(DATA) FROM RESOURCES WHERE ID = ?;`, "/compressible").Scan(&stored)
+	if stored >= len(text)/10 {
+		t.Errorf("expected text to compress well but stored %d bytes", stored)
+	}
+	if r, _ := a.Audit(); !r.OK() {
+		t.Errorf("expected compressed archive to pass audit: %v", r.Discrepancies)
+	}
+}
+
+func TestBrotliCompression(t *testing.T) {
+	a, err := Open(":memory:", WithCompression(6), WithCompressionEncoding(EncodingBrotli))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	text := strings.Repeat("compress me ", 1000)
+	a.Store(TextPlain("/text", text))
+	res, err := a.Load("/text")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	if got := res.Attributes[AttributeEncoding]; got != EncodingBrotli {
+		t.Fatalf("expected encoding %q but got %q", EncodingBrotli, got)
+	}
+	if string(res.Data) != text {
+		t.Fatalf("expected original data to be loaded")
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		encoding       string
+	}{
+		{name: "brotli", acceptEncoding: "gzip, br", encoding: EncodingBrotli},
+		{name: "wildcard", acceptEncoding: "*", encoding: EncodingBrotli},
+		{name: "refused", acceptEncoding: "br;q=0, *", encoding: ""},
+		{name: "none", acceptEncoding: "", encoding: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/text", nil)
+			r.Header.Set("Accept-Encoding", test.acceptEncoding)
+			w := httptest.NewRecorder()
+			NewHandler(a).ServeHTTP(w, r)
+			if got := w.Header().Get("Content-Encoding"); got != test.encoding {
+				t.Fatalf("expected content encoding %q but got %q", test.encoding, got)
+			}
+			body := w.Body.Bytes()
+			if test.encoding != "" {
+				if body, err = ioutil.ReadAll(brotli.NewReader(bytes.NewReader(body))); err != nil {
+					t.Fatalf("expected brotli body: %s", err)
+				}
+			}
+			if string(body) != text {
+				t.Fatalf("expected original data to be served")
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Fatalf("expected to vary by Accept-Encoding but got %q", got)
+			}
+		})
+	}
+}
+
+func TestCompressionKeepsExistingResources(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	text := strings.Repeat("compress me ", 1000)
+	a, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Store(TextPlain("/old", text))
+	a.Close()
+
+	a, err = Open(file, WithCompression(gzip.BestSpeed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.Store(TextPlain("/new", text))
+
+	for _, test := range []struct{ id, encoding string }{{"/old", ""}, {"/new", EncodingGZIP}} {
+		res, err := a.Load(test.id)
+		if err != nil {
+			t.Fatalf("expected load of %s to succeed: %s", test.id, err)
+		}
+		if string(res.Data) != text {
+			t.Fatalf("expected original data for %s", test.id)
+		}
+		if got := res.Attributes[AttributeEncoding]; got != test.encoding {
+			t.Fatalf("expected encoding %q for %s but got %q", test.encoding, test.id, got)
+		}
+		if got, want := res.Attributes[AttributeLength], strconv.Itoa(len(text)); got != want {
+			t.Fatalf("expected length %s for %s but got %s", want, test.id, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// A ConflictPolicy decides what an import does with a resource whose ID is
+// already taken.
+type ConflictPolicy int
+
+const (
+	// ConflictOverwrite replaces the existing resource.
+	ConflictOverwrite ConflictPolicy = iota
+	// ConflictSkip keeps the existing resource.
+	ConflictSkip
+	// ConflictNewerWins replaces the existing resource if the imported one
+	// has a later Last-Modified attribute.
+	ConflictNewerWins
+	// ConflictError fails the whole import with ErrConflict.
+	ConflictError
+)
+
+// resolve reports whether the imported resource with attributes as should be
+// stored under id.
+func (p ConflictPolicy) resolve(ctx context.Context, tx *sql.Tx, id string, as Attributes) (bool, error) {
+	var attributes string
+	err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	switch p {
+	case ConflictOverwrite:
+		return true, nil
+	case ConflictSkip:
+		return false, nil
+	case ConflictNewerWins:
+		existing, err := ParseAttributes(attributes)
+		if err != nil {
+			return false, err
+		}
+		return modified(as).After(modified(existing)), nil
+	case ConflictError:
+		return false, fmt.Errorf("%w: %s", ErrConflict, id)
+	}
+	return false, fmt.Errorf("archive: unknown conflict policy %d", p)
+}
+
+// modified returns the Last-Modified time of as, or the zero time.
+func modified(as Attributes) time.Time {
+	t, _ := time.Parse(time.RFC3339, as[AttributeLastModified])
+	return t
+}
@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Copy duplicates a resource under dstID within the database, so that its
+// data is not loaded. The copy keeps the attributes of the original except
+// for a new Last-Modified. It fails with ErrNotFound if there is no resource
+// srcID and with ErrConflict if there already is one dstID.
+func (a *Archive) Copy(srcID, dstID string) error {
+	return a.copy(srcID, dstID, false)
+}
+
+// ForceCopy is like Copy but replaces a resource dstID, unless it is held.
+func (a *Archive) ForceCopy(srcID, dstID string) error {
+	return a.copy(srcID, dstID, true)
+}
+
+func (a *Archive) copy(srcID, dstID string, overwrite bool) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		var attributes string
+		var size int64
+		err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES, SIZE FROM RESOURCES WHERE ID = ?;`, srcID).Scan(&attributes, &size)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if srcID == dstID {
+			return fmt.Errorf("%w: %s", ErrConflict, dstID)
+		}
+		if ok, err := exists(ctx, tx, dstID); err != nil {
+			return err
+		} else if ok {
+			if !overwrite {
+				return fmt.Errorf("%w: %s", ErrConflict, dstID)
+			}
+			if err := checkHolds(ctx, tx, dstID); err != nil {
+				return err
+			}
+			if _, err := a.remove(ctx, tx, dstID); err != nil {
+				return err
+			}
+		}
+		if err := checkQuota(ctx, tx, dstID, size); err != nil {
+			return err
+		}
+		as, err := ParseAttributes(attributes)
+		if err != nil {
+			return err
+		}
+		a.stamp(ctx, as)
+		_, err = tx.ExecContext(ctx, `INSERT INTO RESOURCES (ID, ATTRIBUTES, DATA, SIZE, MODIFIED, EXTERNAL) SELECT ?, ?, DATA, SIZE, ?, EXTERNAL FROM RESOURCES WHERE ID = ?;`, dstID, as.String(), as[AttributeLastModified], srcID)
+		if err != nil {
+			return err
+		}
+		if err := recordChange(ctx, tx, dstID, changeStored); err != nil {
+			return err
+		}
+		if a.versioning {
+			var data []byte
+			var external sql.NullString
+			if err := tx.QueryRowContext(ctx, `SELECT DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, dstID).Scan(&data, &external); err != nil {
+				return err
+			}
+			if data, err = a.fetch(data, external); err != nil {
+				return err
+			}
+			if err := a.recordVersion(ctx, tx, dstID, as, data); err != nil {
+				return err
+			}
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
@@ -0,0 +1,55 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCopy(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a, err := Open(":memory:", WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(MakeResource("/base", Attributes{AttributeType: TypeTextPlain, AttributeLabel: "template"}, []byte("base document")))
+	a.Store(TextPlain("/taken", "other"))
+	now = now.Add(time.Hour)
+	rev := a.Revision()
+
+	if err := a.Copy("/base", "/taken"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected %v but got %v", ErrConflict, err)
+	}
+	if err := a.Copy("/missing", "/new"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v but got %v", ErrNotFound, err)
+	}
+	if err := a.Copy("/base", "/doc"); err != nil {
+		t.Fatalf("expected copy to succeed: %s", err)
+	}
+	if got := a.Revision(); got != rev+1 {
+		t.Fatalf("expected revision %d but got %d", rev+1, got)
+	}
+	base, _ := a.Load("/base")
+	doc, err := a.Load("/doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(doc.Data) != "base document" || doc.Attributes[AttributeLabel] != "template" {
+		t.Fatalf("expected a copy of %v but got %v", base, doc)
+	}
+	if got, want := doc.Attributes[AttributeLastModified], now.Format(time.RFC3339); got != want {
+		t.Fatalf("expected last modified %s but got %s", want, got)
+	}
+	if base.Attributes[AttributeLastModified] == doc.Attributes[AttributeLastModified] {
+		t.Fatalf("expected the original to keep its last modified")
+	}
+
+	if err := a.ForceCopy("/base", "/taken"); err != nil {
+		t.Fatalf("expected forced copy to succeed: %s", err)
+	}
+	if res, _ := a.Load("/taken"); string(res.Data) != "base document" {
+		t.Fatalf("expected %q but got %q", "base document", res.Data)
+	}
+}
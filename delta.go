@@ -0,0 +1,144 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// A delta describes data in terms of a base: it is the length of the data
+// followed by a sequence of operations, each either copying a range of the
+// base or inserting literal bytes. Matches are found by looking up every
+// window of the data among the aligned blocks of the base, and are extended
+// in both directions, so appended and locally edited data yield small deltas.
+
+const (
+	deltaBlock  = 32
+	deltaCopy   = 'C'
+	deltaInsert = 'I'
+
+	// deltaPrime is the multiplier of the rolling hash of windows.
+	deltaPrime = 1099511628211
+)
+
+var errInvalidDelta = errors.New("archive: invalid delta")
+
+// makeDelta returns the delta describing target in terms of base.
+func makeDelta(base, target []byte) []byte {
+	index := map[uint64]int{}
+	for off := 0; off+deltaBlock <= len(base); off += deltaBlock {
+		h := deltaHash(base[off : off+deltaBlock])
+		if _, ok := index[h]; !ok {
+			index[h] = off
+		}
+	}
+	// pow is deltaPrime^(deltaBlock-1), the weight of the first byte of a window
+	var pow uint64 = 1
+	for i := 1; i < deltaBlock; i++ {
+		pow *= deltaPrime
+	}
+
+	d := &bytes.Buffer{}
+	writeUvarint(d, uint64(len(target)))
+	lit, i := 0, 0
+	var h uint64
+	if len(target) >= deltaBlock {
+		h = deltaHash(target[:deltaBlock])
+	}
+	for i+deltaBlock <= len(target) {
+		if off, ok := index[h]; ok && bytes.Equal(base[off:off+deltaBlock], target[i:i+deltaBlock]) {
+			n := deltaBlock
+			for off+n < len(base) && i+n < len(target) && base[off+n] == target[i+n] {
+				n++
+			}
+			for off > 0 && i > lit && base[off-1] == target[i-1] {
+				off--
+				i--
+				n++
+			}
+			writeInsert(d, target[lit:i])
+			d.WriteByte(deltaCopy)
+			writeUvarint(d, uint64(off))
+			writeUvarint(d, uint64(n))
+			i += n
+			lit = i
+			if i+deltaBlock <= len(target) {
+				h = deltaHash(target[i : i+deltaBlock])
+			}
+			continue
+		}
+		if i+deltaBlock < len(target) {
+			h = (h-uint64(target[i])*pow)*deltaPrime + uint64(target[i+deltaBlock])
+		}
+		i++
+	}
+	writeInsert(d, target[lit:])
+	return d.Bytes()
+}
+
+// applyDelta reconstructs the data described by delta in terms of base.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	r := bytes.NewReader(delta)
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errInvalidDelta
+	}
+	// copies may repeat the base, so size may exceed base and delta together,
+	// but it is not trusted for the allocation before the operations confirm it
+	capacity := size
+	if limit := uint64(len(base)) + uint64(len(delta)); capacity > limit {
+		capacity = limit
+	}
+	out := make([]byte, 0, capacity)
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		switch op {
+		case deltaCopy:
+			off, err1 := binary.ReadUvarint(r)
+			n, err2 := binary.ReadUvarint(r)
+			if err1 != nil || err2 != nil || off > uint64(len(base)) || n > uint64(len(base))-off {
+				return nil, errInvalidDelta
+			}
+			if n > size-uint64(len(out)) {
+				return nil, errInvalidDelta
+			}
+			out = append(out, base[off:off+n]...)
+		case deltaInsert:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > uint64(r.Len()) || n > size-uint64(len(out)) {
+				return nil, errInvalidDelta
+			}
+			lit := make([]byte, n)
+			r.Read(lit)
+			out = append(out, lit...)
+		default:
+			return nil, errInvalidDelta
+		}
+	}
+	if uint64(len(out)) != size {
+		return nil, errInvalidDelta
+	}
+	return out, nil
+}
+
+func deltaHash(window []byte) uint64 {
+	var h uint64
+	for _, b := range window {
+		h = h*deltaPrime + uint64(b)
+	}
+	return h
+}
+
+func writeInsert(d *bytes.Buffer, lit []byte) {
+	if len(lit) == 0 {
+		return
+	}
+	d.WriteByte(deltaInsert)
+	writeUvarint(d, uint64(len(lit)))
+	d.Write(lit)
+}
+
+func writeUvarint(d *bytes.Buffer, v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	d.Write(buf[:binary.PutUvarint(buf[:], v)])
+}
@@ -0,0 +1,121 @@
+package archive
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestDelta(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 10000)
+	rnd.Read(random)
+	edited := append([]byte{}, random...)
+	copy(edited[5000:], "edited")
+	other := make([]byte, 3000)
+	rnd.Read(other)
+
+	tests := []struct {
+		name         string
+		base, target []byte
+	}{
+		{name: "empty", base: nil, target: []byte{}},
+		{name: "same", base: random, target: random},
+		{name: "append", base: random, target: append(append([]byte{}, random...), "appended"...)},
+		{name: "prepend", base: random, target: append([]byte("prepended"), random...)},
+		{name: "edit", base: random, target: edited},
+		{name: "truncate", base: random, target: random[:4321]},
+		{name: "repeat", base: random, target: bytes.Repeat(random, 3)},
+		{name: "unrelated", base: random, target: other},
+		{name: "short", base: []byte("abc"), target: []byte("abd")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := makeDelta(test.base, test.target)
+			got, err := applyDelta(test.base, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(test.target, got) {
+				t.Fatalf("expected the target to be reconstructed")
+			}
+		})
+	}
+	if d := makeDelta(random, edited); len(d) > 100 {
+		t.Fatalf("expected a small delta for a local edit but got %d bytes", len(d))
+	}
+	if _, err := applyDelta(random, []byte{0xff}); err == nil {
+		t.Fatalf("expected an invalid delta to be rejected")
+	}
+}
+
+func TestWithDeltaVersions(t *testing.T) {
+	a, err := Open(":memory:", WithVersioning(), WithDeltaVersions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	rnd := rand.New(rand.NewSource(1))
+	data := make([]byte, 64<<10)
+	rnd.Read(data)
+	var versions [][]byte
+	for i := 0; i < maxDeltaChain+3; i++ {
+		data = append(append([]byte{}, data...), byte(i))
+		data[i*1000] ^= 0xff
+		versions = append(versions, data)
+		if err := a.Store(MakeResource("/big", Attributes{}, data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stored, full int
+	a.db.QueryRow(`SELECT SUM(LENGTH(DATA)), COUNT(*) - COUNT(BASE) FROM HISTORY WHERE ID = ?;`, "/big").Scan(&stored, &full)
+	if stored > 3*len(data) {
+		t.Fatalf("expected deltas to be much smaller than %d full copies but the history has %d bytes", len(versions), stored)
+	}
+	if full != 2 {
+		t.Fatalf("expected %d versions stored in full but got %d", 2, full)
+	}
+	for i, want := range versions {
+		v, err := a.LoadVersion("/big", i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, v.Data) {
+			t.Fatalf("expected version %d to be reconstructed exactly", i+1)
+		}
+	}
+	if err := a.Promote("/big", 1); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := a.Load("/big"); !bytes.Equal(versions[0], res.Data) {
+		t.Fatalf("expected the promoted version to be reconstructed exactly")
+	}
+}
+
+func TestDeltaVersionRepeatingBase(t *testing.T) {
+	a, err := Open(":memory:", WithVersioning(), WithDeltaVersions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	base := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(base)
+	versions := [][]byte{base, bytes.Repeat(base, 3), base}
+	for _, data := range versions {
+		if err := a.Store(MakeResource("/big", Attributes{}, data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, want := range versions {
+		v, err := a.LoadVersion("/big", i+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(want, v.Data) {
+			t.Fatalf("expected version %d to be reconstructed exactly", i+1)
+		}
+	}
+}
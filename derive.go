@@ -0,0 +1,91 @@
+package archive
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type derivation struct {
+	sourceID string
+	fn       func(Resource) (Resource, error)
+}
+
+// RegisterDerivation declares that the resource derivedID is computed from
+// the resource sourceID by fn. Loading derivedID regenerates and stores it
+// whenever the source changed since it was last generated. Read-only archives
+// return the regenerated resource without storing it.
+func (a *Archive) RegisterDerivation(derivedID, sourceID string, fn func(Resource) (Resource, error)) {
+	a.derivationsMu.Lock()
+	defer a.derivationsMu.Unlock()
+	if a.derivations == nil {
+		a.derivations = map[string]derivation{}
+	}
+	a.derivations[derivedID] = derivation{sourceID: sourceID, fn: fn}
+}
+
+func (a *Archive) derivation(id string) (derivation, bool) {
+	a.derivationsMu.Lock()
+	defer a.derivationsMu.Unlock()
+	d, ok := a.derivations[id]
+	return d, ok
+}
+
+func (a *Archive) loadDerived(id string, d derivation) (Resource, error) {
+	src, err := a.Attributes(d.sourceID)
+	if err != nil {
+		return Resource{}, err
+	}
+	version := sourceVersion(src)
+	res, err := a.load(id)
+	switch {
+	case err == nil && res.Attributes[AttributeDerivedFrom] == d.sourceID && res.Attributes[AttributeDerivedFromVersion] == version:
+		return res, nil
+	case err != nil && err != sql.ErrNoRows:
+		return Resource{}, err
+	}
+
+	source, err := a.load(d.sourceID)
+	if err != nil {
+		return Resource{}, err
+	}
+	derived, err := d.fn(source)
+	if err != nil {
+		return Resource{}, err
+	}
+	as := derived.Attributes.Clone()
+	as[AttributeDerivedFrom] = d.sourceID
+	as[AttributeDerivedFromVersion] = sourceVersion(source.Attributes)
+	if a.readOnly {
+		return unstored(id, as, derived.Data), nil
+	}
+	if err := a.Store(MakeResource(id, as, derived.Data)); err != nil {
+		return Resource{}, err
+	}
+	if a.queue != nil {
+		// the store is committed later, so the new resource cannot be loaded
+		return unstored(id, as, derived.Data), nil
+	}
+	return a.load(id)
+}
+
+// unstored returns the resource id as it would be loaded once stored, with
+// the attributes put maintains for data.
+func unstored(id string, attributes Attributes, data []byte) Resource {
+	as := attributes.Clone()
+	sum := Checksum(data)
+	as[AttributeLength] = fmt.Sprintf("%d", len(data))
+	as[AttributeChecksum] = sum
+	if as[AttributeETag] == "" {
+		as[AttributeETag] = etag(sum)
+	}
+	return MakeResource(id, as, data)
+}
+
+// sourceVersion identifies the state of a source resource by its ETag,
+// falling back to its checksum.
+func sourceVersion(as Attributes) string {
+	if etag := as[AttributeETag]; etag != "" {
+		return etag
+	}
+	return as[AttributeChecksum]
+}
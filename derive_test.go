@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestDerivation(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	generated := 0
+	a.RegisterDerivation("/upper", "/text", func(src Resource) (Resource, error) {
+		generated++
+		return TextPlain("", string(bytes.ToUpper(src.Data))), nil
+	})
+
+	a.Store(TextPlain("/text", "hello"))
+	for i := 0; i < 2; i++ {
+		res, err := a.Load("/upper")
+		if err != nil {
+			t.Fatalf("expected load to succeed: %s", err)
+		}
+		if string(res.Data) != "HELLO" {
+			t.Fatalf("expected %q but got %q", "HELLO", res.Data)
+		}
+	}
+	if generated != 1 {
+		t.Fatalf("expected derivation to run %d time but ran %d times", 1, generated)
+	}
+
+	a.Store(TextPlain("/text", "world"))
+	res, err := a.Load("/upper")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	if string(res.Data) != "WORLD" {
+		t.Fatalf("expected %q but got %q", "WORLD", res.Data)
+	}
+	if generated != 2 {
+		t.Fatalf("expected derivation to run %d times but ran %d times", 2, generated)
+	}
+	if got := res.Attributes[AttributeDerivedFrom]; got != "/text" {
+		t.Fatalf("expected derived from %q but got %q", "/text", got)
+	}
+}
+
+func TestDerivationReadOnly(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "archive.db")
+	a, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Store(TextPlain("/text", "hello"))
+	a.Close()
+
+	ro, err := Open(name, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	ro.RegisterDerivation("/upper", "/text", func(src Resource) (Resource, error) {
+		return TextPlain("", string(bytes.ToUpper(src.Data))), nil
+	})
+	res, err := ro.Load("/upper")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	if string(res.Data) != "HELLO" {
+		t.Fatalf("expected %q but got %q", "HELLO", res.Data)
+	}
+	if got, want := res.Attributes[AttributeChecksum], Checksum([]byte("HELLO")); got != want {
+		t.Fatalf("expected checksum %q but got %q", want, got)
+	}
+	if _, err := ro.Attributes("/upper"); err == nil {
+		t.Fatalf("expected derived resource not to be stored")
+	}
+}
+
+func TestDerivationAsyncWrites(t *testing.T) {
+	a, err := Open(":memory:", WithAsyncWrites(100, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.RegisterDerivation("/upper", "/text", func(src Resource) (Resource, error) {
+		return TextPlain("", string(bytes.ToUpper(src.Data))), nil
+	})
+	a.Store(TextPlain("/text", "hello"))
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := a.Load("/upper")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	if string(res.Data) != "HELLO" {
+		t.Fatalf("expected %q but got %q", "HELLO", res.Data)
+	}
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	as, err := a.Attributes("/upper")
+	if err != nil {
+		t.Fatalf("expected derived resource to be stored: %s", err)
+	}
+	if got := as[AttributeDerivedFrom]; got != "/text" {
+		t.Fatalf("expected derived from %q but got %q", "/text", got)
+	}
+}
@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+)
+
+// AddEdge records a relation rel from the resource fromID to the resource
+// toID. Both resources must exist. Edges are removed together with either of
+// their resources. Edges are not resources, so changing them leaves the
+// revision and the change log alone.
+func (a *Archive) AddEdge(fromID, toID, rel string) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		for _, id := range []string{fromID, toID} {
+			if ok, err := exists(ctx, tx, id); err != nil {
+				return err
+			} else if !ok {
+				return sql.ErrNoRows
+			}
+		}
+		_, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO EDGES (FROM_ID, TO_ID, REL) VALUES (?, ?, ?);`, fromID, toID, rel)
+		return err
+	})
+}
+
+func (a *Archive) RemoveEdge(fromID, toID, rel string) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM EDGES WHERE FROM_ID = ? AND TO_ID = ? AND REL = ?;`, fromID, toID, rel)
+		return err
+	})
+}
+
+// Edges returns the IDs of the resources id relates to with rel, ordered by
+// ID. An empty rel matches every relation.
+func (a *Archive) Edges(id string, rel string) ([]string, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	var rows *sql.Rows
+	var err error
+	if rel == "" {
+		rows, err = a.db.QueryContext(ctx, `SELECT DISTINCT TO_ID FROM EDGES WHERE FROM_ID = ? ORDER BY TO_ID;`, id)
+	} else {
+		rows, err = a.db.QueryContext(ctx, `SELECT TO_ID FROM EDGES WHERE FROM_ID = ? AND REL = ? ORDER BY TO_ID;`, id, rel)
+	}
+	if err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var to string
+		if err := rows.Scan(&to); err != nil {
+			return nil, a.translate(ctx, err)
+		}
+		ids = append(ids, to)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	return ids, nil
+}
+
+func exists(ctx context.Context, tx *sql.Tx, id string) (bool, error) {
+	var n int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM RESOURCES WHERE ID = ?;`, id).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,69 @@
+package archive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEdges(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, id := range []string{"/doc", "/doc/a", "/doc/b", "/author"} {
+		a.Store(TextPlain(id, id))
+	}
+	rev := a.Revision()
+	for _, e := range [][3]string{
+		{"/doc", "/doc/a", "attachment"},
+		{"/doc", "/doc/b", "attachment"},
+		{"/doc", "/author", "author"},
+	} {
+		if err := a.AddEdge(e[0], e[1], e[2]); err != nil {
+			t.Fatalf("expected add edge to succeed: %s", err)
+		}
+	}
+	if err := a.AddEdge("/doc", "/missing", "attachment"); err == nil {
+		t.Fatalf("expected edge to a missing resource to fail")
+	}
+	if got := a.Revision(); got != rev {
+		t.Fatalf("expected edges to leave revision %d alone but got %d", rev, got)
+	}
+
+	tests := []struct {
+		rel string
+		out []string
+	}{
+		{rel: "attachment", out: []string{"/doc/a", "/doc/b"}},
+		{rel: "author", out: []string{"/author"}},
+		{rel: "", out: []string{"/author", "/doc/a", "/doc/b"}},
+	}
+	for _, test := range tests {
+		got, err := a.Edges("/doc", test.rel)
+		if err != nil {
+			t.Fatalf("expected edges to succeed: %s", err)
+		}
+		if !reflect.DeepEqual(test.out, got) {
+			t.Errorf("expected %q edges %v but got %v", test.rel, test.out, got)
+		}
+	}
+
+	if err := a.RemoveEdge("/doc", "/author", "author"); err != nil {
+		t.Fatalf("expected remove edge to succeed: %s", err)
+	}
+	if err := a.Delete("/doc/a"); err != nil {
+		t.Fatalf("expected delete to succeed: %s", err)
+	}
+	got, _ := a.Edges("/doc", "")
+	if want := []string{"/doc/b"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected edges %v after delete but got %v", want, got)
+	}
+	a.Delete("/doc")
+	var n int
+	a.db.QueryRow(`SELECT COUNT(*) FROM EDGES;`).Scan(&n)
+	if n != 0 {
+		t.Fatalf("expected all edges to be removed but %d remain", n)
+	}
+}
@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// With WithEncryptionKey the stored data of every resource and version is
+// sealed with AES-GCM, as the random nonce followed by the ciphertext and its
+// authentication tag. Attributes are stored in plain text. An encrypted
+// archive keeps a known text sealed with its key as InfoKeyCheck, so that it
+// cannot be opened with a wrong key or none.
+
+const keyCheck = "archive key check"
+
+// newAEAD returns the AES-GCM cipher for key, which must be 16, 24 or 32
+// bytes long.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("archive: invalid encryption key: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts stored data. A nil data stays nil, so that resources without
+// data keep having none.
+func (a *Archive) seal(stored []byte) ([]byte, error) {
+	if a.aead == nil || stored == nil {
+		return stored, nil
+	}
+	nonce := make([]byte, a.aead.NonceSize(), a.aead.NonceSize()+len(stored)+a.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return a.aead.Seal(nonce, nonce, stored, nil), nil
+}
+
+// open decrypts data sealed by seal. It fails with ErrAuthenticationFailed if
+// the data was sealed with another key or has been tampered with.
+func (a *Archive) open(sealed []byte) ([]byte, error) {
+	if a.aead == nil || sealed == nil {
+		return sealed, nil
+	}
+	n := a.aead.NonceSize()
+	if len(sealed) < n+a.aead.Overhead() {
+		return nil, fmt.Errorf("%w: sealed data is too short", ErrAuthenticationFailed)
+	}
+	stored, err := a.aead.Open(make([]byte, 0, len(sealed)-n-a.aead.Overhead()), sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong encryption key or tampered data", ErrAuthenticationFailed)
+	}
+	return stored, nil
+}
+
+// checkKey checks the encryption key against the key check of db, which it
+// records for new encrypted archives. It fails with ErrEncrypted if db is
+// encrypted and there is no key, and with ErrAuthenticationFailed if the key
+// is wrong.
+func (a *Archive) checkKey(ctx context.Context, db *sql.DB) error {
+	var check string
+	err := db.QueryRowContext(ctx, `SELECT VALUE FROM INFO WHERE NAME = ?;`, InfoKeyCheck).Scan(&check)
+	switch {
+	case err == sql.ErrNoRows && a.aead == nil:
+		return nil
+	case err == sql.ErrNoRows:
+		var n int
+		if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM RESOURCES;`).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("archive: encryption key given, but the archive has unencrypted resources")
+		}
+		if a.readOnly {
+			return nil
+		}
+		sealed, err := a.seal([]byte(keyCheck))
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx, `INSERT INTO INFO (NAME, VALUE) VALUES (?, ?);`, InfoKeyCheck, hex.EncodeToString(sealed))
+		return err
+	case err != nil:
+		return err
+	case a.aead == nil:
+		return ErrEncrypted
+	}
+	sealed, err := hex.DecodeString(check)
+	if err != nil {
+		return fmt.Errorf("%w: invalid key check: %v", ErrCorrupt, err)
+	}
+	if plain, err := a.open(sealed); err != nil || string(plain) != keyCheck {
+		return fmt.Errorf("%w: wrong encryption key", ErrAuthenticationFailed)
+	}
+	return nil
+}
+
+// sealOverhead returns the number of bytes seal adds to data.
+func (a *Archive) sealOverhead() int64 {
+	if a.aead == nil {
+		return 0
+	}
+	return int64(a.aead.NonceSize() + a.aead.Overhead())
+}
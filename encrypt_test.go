@@ -0,0 +1,100 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithEncryptionKey(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	key := bytes.Repeat([]byte{1}, 32)
+	a, err := Open(file, WithEncryptionKey(key), WithVersioning(), WithInlineThreshold(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := "social security number 123-45-6789"
+	large := strings.Repeat("secret ", 20)
+	a.Store(TextPlain("/pii", secret))
+	a.Store(TextPlain("/large", large))
+	a.Store(MakeResource("/empty", Attributes{}, nil))
+
+	var raw []byte
+	a.db.QueryRow(`SELECT DATA FROM RESOURCES WHERE ID = ?;`, "/pii").Scan(&raw)
+	if bytes.Contains(raw, []byte("123-45-6789")) {
+		t.Fatalf("expected the data to be encrypted but got %q", raw)
+	}
+	a.db.QueryRow(`SELECT DATA FROM HISTORY WHERE ID = ?;`, "/pii").Scan(&raw)
+	if bytes.Contains(raw, []byte("123-45-6789")) {
+		t.Fatalf("expected the version to be encrypted but got %q", raw)
+	}
+	infos, _ := ioutil.ReadDir(file + ".blobs")
+	for _, info := range infos {
+		data, _ := ioutil.ReadFile(filepath.Join(file+".blobs", info.Name()))
+		if bytes.Contains(data, []byte("secret")) {
+			t.Fatalf("expected the external data to be encrypted")
+		}
+	}
+
+	for id, want := range map[string]string{"/pii": secret, "/large": large} {
+		res, err := a.Load(id)
+		if err != nil || string(res.Data) != want {
+			t.Fatalf("expected %q but got %q (%v)", want, res.Data, err)
+		}
+		if err := a.Verify(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if res, err := a.Load("/empty"); err != nil || res.Data != nil {
+		t.Fatalf("expected no data but got %q (%v)", res.Data, err)
+	}
+	if v, err := a.LoadVersion("/pii", 1); err != nil || string(v.Data) != secret {
+		t.Fatalf("expected %q but got %q (%v)", secret, v.Data, err)
+	}
+	buf := &bytes.Buffer{}
+	if err := a.ExportPack(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := OpenPack(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := p.Load("/pii"); err != nil || string(res.Data) != secret {
+		t.Fatalf("expected %q in the pack but got %q (%v)", secret, res.Data, err)
+	}
+	a.Close()
+
+	if _, err := Open(file, WithEncryptionKey(bytes.Repeat([]byte{2}, 32))); !errors.Is(err, ErrAuthenticationFailed) {
+		t.Fatalf("expected %v for a wrong key but got %v", ErrAuthenticationFailed, err)
+	}
+	if _, err := Open(file); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("expected %v without a key but got %v", ErrEncrypted, err)
+	}
+	a, err = Open(file, WithEncryptionKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.db.Exec(`UPDATE RESOURCES SET DATA = ? WHERE ID = ?;`, bytes.Repeat([]byte{0}, 64), "/pii")
+	if failed, err := a.VerifyAllParallel(2); err != nil || len(failed) != 1 || failed[0] != "/pii" {
+		t.Fatalf("expected /pii to fail verification but got %v (%v)", failed, err)
+	}
+	a.Close()
+
+	plain := filepath.Join(t.TempDir(), "plain.db")
+	u, err := Open(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Store(TextPlain("/a", "a"))
+	u.Close()
+	if _, err := Open(plain, WithEncryptionKey(key)); err == nil {
+		t.Fatalf("expected a key for an unencrypted archive to be rejected")
+	}
+
+	if _, err := Open(":memory:", WithEncryptionKey([]byte("short"))); err == nil {
+		t.Fatalf("expected an invalid key to be rejected")
+	}
+}
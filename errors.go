@@ -0,0 +1,50 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrAttributesTooLarge   = errors.New("archive: attributes too large")
+	ErrAuthenticationFailed = errors.New("archive: data authentication failed")
+	ErrChecksumMismatch     = errors.New("archive: checksum mismatch")
+	ErrClosed               = errors.New("archive: closed")
+	ErrConflict             = errors.New("archive: resource already exists")
+	ErrCorrupt              = errors.New("archive: database is corrupt")
+	ErrDriverUnavailable    = errors.New("archive: sql driver unavailable")
+	ErrEncrypted            = errors.New("archive: encrypted, but no encryption key given")
+	ErrETagMismatch         = errors.New("archive: etag mismatch")
+	ErrInMemory             = errors.New("archive: not supported by in-memory archives")
+	ErrInUse                = errors.New("archive: resource is in use")
+	ErrInvalidVariant       = errors.New("archive: invalid variant key")
+	ErrNotModified          = errors.New("archive: not modified")
+	ErrQuotaExceeded        = errors.New("archive: quota exceeded")
+	ErrReadOnly             = errors.New("archive: read-only")
+	ErrSchemaViolation      = errors.New("archive: schema violation")
+	ErrUnsupportedType      = errors.New("archive: unsupported type")
+)
+
+// ErrNotFound matches sql.ErrNoRows with errors.Is, which is what most
+// methods return for missing resources.
+var ErrNotFound = fmt.Errorf("archive: resource not found: %w", sql.ErrNoRows)
+
+// ErrTimeout is returned by operations that exceed the default timeout. It
+// matches context.DeadlineExceeded with errors.Is.
+var ErrTimeout error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string {
+	return "archive: operation timed out"
+}
+
+func (timeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+func (timeoutError) Timeout() bool {
+	return true
+}
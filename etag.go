@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// etag returns the strong ETag computed by put for data with the checksum
+// sum.
+func etag(sum string) string {
+	_, digest := splitChecksum(sum)
+	return `"` + digest + `"`
+}
+
+// storedETag returns the ETag of the stored resource id, or "" if there is
+// none.
+func storedETag(ctx context.Context, tx *sql.Tx, id string) (string, error) {
+	var attributes string
+	err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	as, err := ParseAttributes(attributes)
+	return as[AttributeETag], err
+}
+
+// StoreIfMatch stores a resource only if the ETag of its stored version is
+// etag, failing with ErrETagMismatch otherwise, including when there is no
+// stored version.
+func (a *Archive) StoreIfMatch(r Resource, etag string) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	as := r.Attributes
+	sum := Checksum(r.Data)
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		var attributes string
+		err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES FROM RESOURCES WHERE ID = ?;`, r.ID).Scan(&attributes)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %s does not exist", ErrETagMismatch, r.ID)
+		}
+		if err != nil {
+			return err
+		}
+		stored, err := ParseAttributes(attributes)
+		if err != nil {
+			return err
+		}
+		if got := stored[AttributeETag]; got != etag {
+			return fmt.Errorf("%w: %s has %s", ErrETagMismatch, r.ID, got)
+		}
+		if err := a.put(ctx, tx, r.ID, as, r.Data, sum); err != nil {
+			return err
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
+
+// LoadIfNoneMatch loads a resource unless its ETag is etag, in which case it
+// returns ErrNotModified without loading the data. An empty etag matches
+// nothing.
+func (a *Archive) LoadIfNoneMatch(id, etag string) (Resource, error) {
+	as, err := a.Attributes(id)
+	if err != nil {
+		return Resource{}, err
+	}
+	if etag != "" && as[AttributeETag] == etag {
+		return Resource{}, ErrNotModified
+	}
+	return a.Load(id)
+}
@@ -0,0 +1,100 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestETag(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "hello"))
+	res, _ := a.Load("/a")
+	tag := res.Attributes[AttributeETag]
+	if want := `"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"`; tag != want {
+		t.Fatalf("expected etag %s but got %s", want, tag)
+	}
+	a.Store(MakeResource("/custom", Attributes{AttributeETag: `"v1"`}, []byte("x")))
+	if as, _ := a.Attributes("/custom"); as[AttributeETag] != `"v1"` {
+		t.Fatalf("expected the supplied etag to be kept but got %s", as[AttributeETag])
+	}
+
+	if _, err := a.LoadIfNoneMatch("/a", tag); err != ErrNotModified {
+		t.Fatalf("expected %v but got %v", ErrNotModified, err)
+	}
+	if got, err := a.LoadIfNoneMatch("/a", `"other"`); err != nil || string(got.Data) != "hello" {
+		t.Fatalf("expected the resource to be loaded but got %v, %v", got, err)
+	}
+	a.db.Exec(`INSERT INTO RESOURCES (ID, ATTRIBUTES, DATA, SIZE) VALUES (?, ?, ?, ?);`, "/untagged", "Type: text/plain\r\n", []byte("legacy"), 6)
+	if got, err := a.LoadIfNoneMatch("/untagged", ""); err != nil || string(got.Data) != "legacy" {
+		t.Fatalf("expected a resource without an etag to be loaded but got %v, %v", got, err)
+	}
+
+	res.Data = []byte("world")
+	if err := a.StoreIfMatch(res, tag); err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+	updated, _ := a.Attributes("/a")
+	if updated[AttributeETag] == tag {
+		t.Fatalf("expected a new etag for the new data")
+	}
+	if err := a.StoreIfMatch(res, tag); !errors.Is(err, ErrETagMismatch) {
+		t.Fatalf("expected %v but got %v", ErrETagMismatch, err)
+	}
+	if err := a.StoreIfMatch(TextPlain("/missing", "x"), tag); !errors.Is(err, ErrETagMismatch) {
+		t.Fatalf("expected %v but got %v", ErrETagMismatch, err)
+	}
+	if got, _ := a.Load("/a"); string(got.Data) != "world" {
+		t.Fatalf("expected %q but got %q", "world", got.Data)
+	}
+}
+
+func TestETagFollowsData(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	check := func(id string) {
+		t.Helper()
+		res, err := a.Load(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := etag(Checksum(res.Data)); res.Attributes[AttributeETag] != want {
+			t.Fatalf("expected etag %s for %s but got %s", want, id, res.Attributes[AttributeETag])
+		}
+	}
+
+	a.Store(TextPlain("/upload", "hello"))
+	a.WriteAt("/upload", 0, []byte("jello"))
+	a.Finalize("/upload")
+	check("/upload")
+
+	a.Store(GenericJSON("/doc", map[string]int{"a": 1}))
+	if err := a.PatchJSON("/doc", []byte(`{"b":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	check("/doc")
+
+	a.Store(TextPlain("/text", "old"))
+	export := &bytes.Buffer{}
+	a.ExportAttributes(export)
+	a.Store(TextPlain("/text", "new"))
+	if _, err := a.ApplyAttributes(export); err != nil {
+		t.Fatal(err)
+	}
+	check("/text")
+
+	a.Store(MakeResource("/custom", Attributes{AttributeETag: `"v1"`}, []byte("x")))
+	res, _ := a.Load("/custom")
+	res.Data = []byte("y")
+	a.Store(res)
+	check("/custom")
+}
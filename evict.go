@@ -0,0 +1,94 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+)
+
+// Pin marks a resource as exempt from eviction.
+func (a *Archive) Pin(id string) error {
+	return a.setAttributes(id, func(as Attributes) {
+		as[AttributePinned] = "true"
+	})
+}
+
+func (a *Archive) Unpin(id string) error {
+	return a.setAttributes(id, func(as Attributes) {
+		delete(as, AttributePinned)
+	})
+}
+
+// EvictToSize deletes the least recently modified resources until the total
+// data length of the archive is at most maxBytes. Pinned and held resources
+// are never evicted, so the archive may remain above maxBytes. It returns
+// the number of evicted resources.
+func (a *Archive) EvictToSize(maxBytes int64) (int, error) {
+	if err := a.writable(); err != nil {
+		return 0, err
+	}
+
+	type candidate struct {
+		id       string
+		modified string
+		size     int64
+	}
+	n := 0
+	err := a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `SELECT ID, ATTRIBUTES, SIZE FROM RESOURCES;`)
+		if err != nil {
+			return err
+		}
+		var total int64
+		var cs []candidate
+		for rows.Next() {
+			var id, attributes string
+			var size int64
+			if err := rows.Scan(&id, &attributes, &size); err != nil {
+				rows.Close()
+				return err
+			}
+			total += size
+			as, _ := ParseAttributes(attributes)
+			if as[AttributePinned] == "true" {
+				continue
+			}
+			cs = append(cs, candidate{id: id, modified: as[AttributeLastModified], size: size})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		sort.Slice(cs, func(i, j int) bool {
+			if cs[i].modified != cs[j].modified {
+				return cs[i].modified < cs[j].modified
+			}
+			return cs[i].id < cs[j].id
+		})
+		for _, c := range cs {
+			if total <= maxBytes {
+				break
+			}
+			if err := checkHolds(ctx, tx, c.id); errors.Is(err, ErrInUse) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if _, err := a.remove(ctx, tx, c.id); err != nil {
+				return err
+			}
+			total -= c.size
+			n++
+		}
+		if n > 0 {
+			return bumpRevision(ctx, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
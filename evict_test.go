@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestEvictToSizeKeepsPinned(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for i := 1; i <= 5; i++ {
+		a.Store(MakeResource(fmt.Sprintf("/%d", i), Attributes{}, make([]byte, 100)))
+	}
+	if err := a.Pin("/1"); err != nil {
+		t.Fatalf("expected pin to succeed: %s", err)
+	}
+	if err := a.Pin("/missing"); err == nil {
+		t.Fatalf("expected pin of missing resource to fail")
+	}
+
+	n, err := a.EvictToSize(250)
+	if err != nil {
+		t.Fatalf("expected evict to succeed: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected %d evicted resources but got %d", 3, n)
+	}
+	ds, _ := a.List()
+	got := []string{}
+	for _, d := range ds {
+		got = append(got, d.ID)
+	}
+	if want := []string{"/1", "/5"}; !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v to remain but got %v", want, got)
+	}
+	res, _ := a.Load("/1")
+	if len(res.Data) != 100 {
+		t.Fatalf("expected pinning to keep the data but got %d bytes", len(res.Data))
+	}
+
+	if n, _ := a.EvictToSize(0); n != 1 {
+		t.Fatalf("expected only the unpinned resource to be evicted but got %d", n)
+	}
+	a.Unpin("/1")
+	if n, _ := a.EvictToSize(0); n != 1 {
+		t.Fatalf("expected unpinned resource to be evicted but got %d", n)
+	}
+}
+
+func TestEvictToSizeKeepsHeld(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(MakeResource("/held", Attributes{}, make([]byte, 100)))
+	a.Store(MakeResource("/free", Attributes{}, make([]byte, 100)))
+	if err := a.Retain("/held"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := a.EvictToSize(0); err != nil || n != 1 {
+		t.Fatalf("expected only the free resource to be evicted but got %d: %v", n, err)
+	}
+	if ok, _ := a.Exists("/held"); !ok {
+		t.Fatalf("expected the held resource to remain")
+	}
+}
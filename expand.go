@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type ExpandOption func(*expandConfig)
+
+type expandConfig struct {
+	attributes bool
+	strict     bool
+}
+
+// ExpandAttributes resolves placeholders not found in the provided variables
+// from the attributes of the resource itself.
+func ExpandAttributes() ExpandOption {
+	return func(c *expandConfig) {
+		c.attributes = true
+	}
+}
+
+// ExpandStrict makes unresolved placeholders an error instead of leaving them
+// in place.
+func ExpandStrict() ExpandOption {
+	return func(c *expandConfig) {
+		c.strict = true
+	}
+}
+
+var placeholder = regexp.MustCompile(`\$\{([^{}]+)\}`)
+
+// LoadExpanded loads a text resource and substitutes its ${name}
+// placeholders with the values from vars.
+func (a *Archive) LoadExpanded(id string, vars map[string]string, opts ...ExpandOption) (string, error) {
+	c := expandConfig{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	res, err := a.Load(id)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(res.Attributes.MediaType(), "text/") {
+		return "", fmt.Errorf("archive: cannot expand %s of type %q", id, res.Attributes[AttributeType])
+	}
+	var unresolved []string
+	out := placeholder.ReplaceAllStringFunc(string(res.Data), func(m string) string {
+		name := m[2 : len(m)-1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		if v, ok := res.Attributes[name]; ok && c.attributes {
+			return v
+		}
+		unresolved = append(unresolved, name)
+		return m
+	})
+	if c.strict && len(unresolved) > 0 {
+		return "", fmt.Errorf("archive: unresolved placeholders in %s: %s", id, strings.Join(unresolved, ", "))
+	}
+	return out, nil
+}
@@ -0,0 +1,45 @@
+package archive
+
+import "testing"
+
+func TestLoadExpanded(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(MakeResource("/greeting", Attributes{AttributeType: TypeTextPlain, AttributeLabel: "Greeting"}, []byte("${Label}: Hello ${name}, ${missing}!")))
+	a.Store(JPEG("/image", []byte{0xff, 0xd8}))
+
+	tests := []struct {
+		name string
+		opts []ExpandOption
+		out  string
+		err  bool
+	}{
+		{name: "vars", out: "${Label}: Hello World, ${missing}!"},
+		{name: "attributes", opts: []ExpandOption{ExpandAttributes()}, out: "Greeting: Hello World, ${missing}!"},
+		{name: "strict", opts: []ExpandOption{ExpandStrict()}, err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := a.LoadExpanded("/greeting", map[string]string{"name": "World"}, test.opts...)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected expansion to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected expansion to succeed: %s", err)
+			}
+			if got != test.out {
+				t.Errorf("expected %q but got %q", test.out, got)
+			}
+		})
+	}
+	if _, err := a.LoadExpanded("/image", nil); err == nil {
+		t.Fatalf("expected expansion of non-text resource to fail")
+	}
+}
@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// StoreWithTTL stores r with an Expires attribute ttl from now.
+func (a *Archive) StoreWithTTL(r Resource, ttl time.Duration) error {
+	as := r.Attributes.Clone()
+	as[AttributeExpires] = a.now().Add(ttl).Format(time.RFC3339)
+	return a.store(r.ID, as, r.Data, Checksum(r.Data))
+}
+
+// Fresh reports whether a resource has not expired yet. Resources without a
+// valid Expires attribute never expire.
+func (a *Archive) Fresh(id string) (bool, error) {
+	as, err := a.Attributes(id)
+	if err != nil {
+		return false, err
+	}
+	return !a.expired(as), nil
+}
+
+func (a *Archive) expired(as Attributes) bool {
+	t, err := time.Parse(time.RFC3339, as[AttributeExpires])
+	return err == nil && !a.now().Before(t)
+}
+
+// PurgeExpired deletes every expired resource that is not held and returns
+// their number.
+func (a *Archive) PurgeExpired() (int, error) {
+	if err := a.writable(); err != nil {
+		return 0, err
+	}
+	n := 0
+	err := a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		ids, err := matching(ctx, tx, a.expired)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := checkHolds(ctx, tx, id); errors.Is(err, ErrInUse) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if _, err := a.remove(ctx, tx, id); err != nil {
+				return err
+			}
+			n++
+		}
+		if n > 0 {
+			return bumpRevision(ctx, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreWithTTL(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	a, err := Open(":memory:", WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.StoreWithTTL(TextPlain("/cached", "cached"), time.Hour); err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+	a.Store(TextPlain("/kept", "kept"))
+	as, _ := a.Attributes("/cached")
+	if got, want := as[AttributeExpires], "2020-01-01T13:00:00Z"; got != want {
+		t.Fatalf("expected expires %q but got %q", want, got)
+	}
+	if fresh, err := a.Fresh("/cached"); err != nil || !fresh {
+		t.Fatalf("expected resource to be fresh: %v", err)
+	}
+	if n, _ := a.PurgeExpired(); n != 0 {
+		t.Fatalf("expected nothing to purge but purged %d", n)
+	}
+
+	now = now.Add(time.Hour)
+	if fresh, _ := a.Fresh("/cached"); fresh {
+		t.Fatalf("expected resource to have expired")
+	}
+	if fresh, _ := a.Fresh("/kept"); !fresh {
+		t.Fatalf("expected resource without expiry to be fresh")
+	}
+	if n, err := a.PurgeExpired(); err != nil || n != 1 {
+		t.Fatalf("expected %d purged resource but got %d: %v", 1, n, err)
+	}
+	if ds, _ := a.List(); len(ds) != 1 || ds[0].ID != "/kept" {
+		t.Fatalf("expected only /kept to remain but got %v", ds)
+	}
+}
+
+func TestPurgeExpiredKeepsHeld(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	a, err := Open(":memory:", WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.StoreWithTTL(TextPlain("/held", "held"), time.Hour)
+	a.StoreWithTTL(TextPlain("/free", "free"), time.Hour)
+	if err := a.Retain("/held"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Hour)
+	if n, err := a.PurgeExpired(); err != nil || n != 1 {
+		t.Fatalf("expected only the free resource to be purged but got %d: %v", n, err)
+	}
+	if ok, _ := a.Exists("/held"); !ok {
+		t.Fatalf("expected the held resource to remain")
+	}
+}
+
+func TestStoreWithTTLAfterQueuedStore(t *testing.T) {
+	a, err := Open(":memory:", WithAsyncWrites(10, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/cached", "old"))
+	if err := a.StoreWithTTL(TextPlain("/cached", "new"), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	a.Flush()
+	res, _ := a.Load("/cached")
+	if string(res.Data) != "new" || !res.Attributes.Has(AttributeExpires) {
+		t.Fatalf("expected the later store with a TTL to win but got %q %v", res.Data, res.Attributes)
+	}
+}
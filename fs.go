@@ -0,0 +1,155 @@
+package archive
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FS returns a read-only view of the archive as an fs.FS. The name of a file
+// is the ID of its resource without the leading slash, and directories are
+// implied by the IDs below them. Files hold the decoded data whatever the
+// Encoding of their resources, since fs.FS consumers know nothing about
+// content encodings; use the Handler to serve the encoded form.
+func (a *Archive) FS() fs.FS {
+	return archiveFS{a: a}
+}
+
+type archiveFS struct {
+	a *Archive
+}
+
+func (f archiveFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		res, err := f.a.Load("/" + name)
+		if err == nil {
+			info := fileInfo{name: base(name), size: int64(len(res.Data)), modTime: modified(res.Attributes)}
+			return &file{info: info, r: bytes.NewReader(res.Data)}, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	entries, err := f.entries(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if len(entries) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &dir{info: fileInfo{name: base(name), dir: true}, entries: entries}, nil
+}
+
+// entries lists the files and directories directly below the directory name.
+func (f archiveFS) entries(name string) ([]fs.DirEntry, error) {
+	prefix := "/"
+	if name != "." {
+		prefix = "/" + name + "/"
+	}
+	ds, err := f.a.ListWithPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var entries []fs.DirEntry
+	for _, d := range ds {
+		if !strings.HasPrefix(d.ID, prefix) {
+			continue
+		}
+		rest := d.ID[len(prefix):]
+		info := fileInfo{name: rest, modTime: modified(d.Attributes)}
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			info = fileInfo{name: rest[:i], dir: true}
+		} else {
+			info.size, _ = strconv.ParseInt(d.Attributes[AttributeLength], 10, 64)
+		}
+		if info.name == "" || seen[info.name] {
+			continue
+		}
+		seen[info.name] = true
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func base(name string) string {
+	return name[strings.LastIndexByte(name, '/')+1:]
+}
+
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return i.modTime }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() interface{}   { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+type file struct {
+	info fileInfo
+	r    *bytes.Reader
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *file) Read(p []byte) (int, error) { return f.r.Read(p) }
+func (f *file) Close() error               { return nil }
+
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	return f.r.Seek(offset, whence)
+}
+
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	return f.r.ReadAt(p, off)
+}
+
+type dir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dir) Close() error               { return nil }
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
@@ -0,0 +1,40 @@
+package archive
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	a, err := Open(":memory:", WithCompression(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	page := strings.Repeat("<p>hello, world</p>\n", 50)
+	a.Store(MakeResource("/site/index.html", Attributes{AttributeType: TypeTextHTML}, []byte(page)))
+	a.Store(TextPlain("/site/css/main.css", "body {}"))
+	a.Store(TextPlain("/readme.txt", "read me"))
+	if as, _ := a.Attributes("/site/index.html"); as[AttributeEncoding] != EncodingGZIP {
+		t.Fatalf("expected %s to be stored gzip-encoded but got %q", "/site/index.html", as[AttributeEncoding])
+	}
+
+	fsys := a.FS()
+	data, err := fs.ReadFile(fsys, "site/index.html")
+	if err != nil {
+		t.Fatalf("expected read to succeed: %s", err)
+	}
+	if string(data) != page {
+		t.Fatalf("expected the decoded page but got %q", data)
+	}
+	if _, err := fs.ReadFile(fsys, "site/missing.html"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected %v but got %v", fs.ErrNotExist, err)
+	}
+	if err := fstest.TestFS(fsys, "readme.txt", "site/index.html", "site/css/main.css"); err != nil {
+		t.Fatal(err)
+	}
+}
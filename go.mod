@@ -1,8 +1,8 @@
 module github.com/cognicraft/archive
 
-go 1.12
+go 1.16
 
 require (
-	github.com/cognicraft/sqlutil v0.1.0
+	github.com/andybalholm/brotli v1.0.6
 	github.com/mattn/go-sqlite3 v1.14.8
 )
@@ -0,0 +1,62 @@
+package archive
+
+import (
+	"net/http"
+	"time"
+)
+
+// headers maps HTTP header names to the attributes they correspond to.
+var headers = []struct {
+	header    string
+	attribute string
+	time      bool
+}{
+	{header: "Content-Encoding", attribute: AttributeEncoding},
+	{header: "Content-Length", attribute: AttributeLength},
+	{header: "Content-Type", attribute: AttributeType},
+	{header: "ETag", attribute: AttributeETag},
+	{header: "Expires", attribute: AttributeExpires, time: true},
+	{header: "Last-Modified", attribute: AttributeLastModified, time: true},
+}
+
+// AttributesFromHeader builds attributes from the recognized headers of h.
+// Dates are converted to the format used by time valued attributes; headers
+// with unparseable dates are skipped.
+func AttributesFromHeader(h http.Header) Attributes {
+	as := Attributes{}
+	for _, m := range headers {
+		v := h.Get(m.header)
+		if v == "" {
+			continue
+		}
+		if m.time {
+			t, err := http.ParseTime(v)
+			if err != nil {
+				continue
+			}
+			v = t.UTC().Format(time.RFC3339)
+		}
+		as[m.attribute] = v
+	}
+	return as
+}
+
+// Header is the reverse of AttributesFromHeader.
+func (as Attributes) Header() http.Header {
+	h := http.Header{}
+	for _, m := range headers {
+		v, ok := as[m.attribute]
+		if !ok {
+			continue
+		}
+		if m.time {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				continue
+			}
+			v = t.UTC().Format(http.TimeFormat)
+		}
+		h.Set(m.header, v)
+	}
+	return h
+}
@@ -0,0 +1,36 @@
+package archive
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestAttributesFromHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Length", "42")
+	h.Set("Content-Encoding", EncodingGZIP)
+	h.Set("ETag", `"abc"`)
+	h.Set("Last-Modified", "Sat, 29 Feb 2020 11:30:00 GMT")
+	h.Set("Expires", "Sun, 01 Mar 2020 00:00:00 GMT")
+	h.Set("Server", "test")
+
+	as := AttributesFromHeader(h)
+	want := Attributes{
+		AttributeType:         "text/html; charset=utf-8",
+		AttributeLength:       "42",
+		AttributeEncoding:     EncodingGZIP,
+		AttributeETag:         `"abc"`,
+		AttributeLastModified: "2020-02-29T11:30:00Z",
+		AttributeExpires:      "2020-03-01T00:00:00Z",
+	}
+	if !reflect.DeepEqual(want, as) {
+		t.Fatalf("expected %v but got %v", want, as)
+	}
+
+	h.Del("Server")
+	if got := as.Header(); !reflect.DeepEqual(h, got) {
+		t.Fatalf("expected %v but got %v", h, got)
+	}
+}
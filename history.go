@@ -0,0 +1,164 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// The history of a resource records a tombstone, a row without attributes,
+// at the revision that deleted it. With WithDeltaVersions the DATA of a
+// version may be a delta against the version at revision BASE.
+
+// maxDeltaChain bounds the number of deltas applied to load a version. A
+// version that would need more is stored in full.
+const maxDeltaChain = 16
+
+// LoadVersion loads the version of a resource stored at revision. It fails
+// with ErrNotFound if the resource was deleted at revision.
+func (a *Archive) LoadVersion(id string, revision int) (Resource, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	attributes, data, _, err := a.version(ctx, a.db, id, revision)
+	if err != nil {
+		return Resource{}, a.translate(ctx, err)
+	}
+	if !attributes.Valid {
+		return Resource{}, deletedAt(id, revision)
+	}
+	as, err := ParseAttributes(attributes.String)
+	if err != nil {
+		return Resource{}, err
+	}
+	if data, err = decode(as, data); err != nil {
+		return Resource{}, err
+	}
+	return MakeResource(id, as, data), nil
+}
+
+// History returns the revisions at which a resource was stored or deleted,
+// in ascending order. It is empty unless WithVersioning is used.
+func (a *Archive) History(id string) ([]int, error) {
+	ctx, cancel := a.context()
+	defer cancel()
+	rows, err := a.db.QueryContext(ctx, `SELECT REVISION FROM HISTORY WHERE ID = ? ORDER BY REVISION;`, id)
+	if err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	defer rows.Close()
+	var revisions []int
+	for rows.Next() {
+		var revision int
+		if err := rows.Scan(&revision); err != nil {
+			return nil, a.translate(ctx, err)
+		}
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, a.translate(ctx, err)
+	}
+	return revisions, nil
+}
+
+func deletedAt(id string, revision int) error {
+	return fmt.Errorf("%w: %s was deleted at revision %d", ErrNotFound, id, revision)
+}
+
+// Promote makes the version of a resource stored at revision its current
+// version again. This is a regular store and bumps the revision.
+func (a *Archive) Promote(id string, revision int) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		attributes, data, _, err := a.version(ctx, tx, id, revision)
+		if err != nil {
+			return err
+		}
+		if !attributes.Valid {
+			return deletedAt(id, revision)
+		}
+		as, err := ParseAttributes(attributes.String)
+		if err != nil {
+			return err
+		}
+		if data, err = decode(as, data); err != nil {
+			return err
+		}
+		if err := a.put(ctx, tx, id, as, data, Checksum(data)); err != nil {
+			return err
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
+
+// recordVersion adds the state of a resource to its history under the
+// revision the current transaction is going to commit.
+func (a *Archive) recordVersion(ctx context.Context, tx *sql.Tx, id string, as Attributes, data []byte) error {
+	var revision int
+	if err := tx.QueryRowContext(ctx, `SELECT VALUE + 1 FROM INFO WHERE NAME = ?;`, InfoRevision).Scan(&revision); err != nil {
+		return err
+	}
+	var base sql.NullInt64
+	if a.deltaVersions && data != nil {
+		var prev int
+		err := tx.QueryRowContext(ctx, `SELECT REVISION FROM HISTORY WHERE ID = ? AND REVISION < ? ORDER BY REVISION DESC LIMIT 1;`, id, revision).Scan(&prev)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil {
+			_, prevData, depth, err := a.version(ctx, tx, id, prev)
+			if err != nil {
+				return err
+			}
+			if prevData != nil && depth < maxDeltaChain {
+				if d := makeDelta(prevData, data); len(d) < len(data) {
+					data, base = d, sql.NullInt64{Int64: int64(prev), Valid: true}
+				}
+			}
+		}
+	}
+	data, err := a.seal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT OR REPLACE INTO HISTORY (ID, REVISION, ATTRIBUTES, DATA, BASE) VALUES (?, ?, ?, ?, ?);`, id, revision, as.String(), data, base)
+	return err
+}
+
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// version returns the attributes and the stored data of the version of a
+// resource at revision, applying deltas as needed, together with the number
+// of deltas applied.
+func (a *Archive) version(ctx context.Context, q rowQuerier, id string, revision int) (sql.NullString, []byte, int, error) {
+	var attributes sql.NullString
+	var data []byte
+	var base sql.NullInt64
+	if err := q.QueryRowContext(ctx, `SELECT ATTRIBUTES, DATA, BASE FROM HISTORY WHERE ID = ? AND REVISION = ?;`, id, revision).Scan(&attributes, &data, &base); err != nil {
+		return attributes, nil, 0, err
+	}
+	data, err := a.open(data)
+	if err != nil || !base.Valid {
+		return attributes, data, 0, err
+	}
+	_, baseData, depth, err := a.version(ctx, q, id, int(base.Int64))
+	if err == sql.ErrNoRows {
+		return attributes, nil, 0, fmt.Errorf("%w: base %d of version %d of %s is missing", ErrCorrupt, base.Int64, revision, id)
+	}
+	if err != nil {
+		return attributes, nil, 0, err
+	}
+	if data, err = applyDelta(baseData, data); err != nil {
+		return attributes, nil, 0, fmt.Errorf("%w: version %d of %s: %v", ErrCorrupt, revision, id, err)
+	}
+	return attributes, data, depth + 1, nil
+}
+
+// recordTombstone records the deletion of a resource in its history.
+func recordTombstone(ctx context.Context, tx *sql.Tx, id string) error {
+	_, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO HISTORY (ID, REVISION, ATTRIBUTES, DATA) SELECT ?, VALUE + 1, NULL, NULL FROM INFO WHERE NAME = ?;`, id, InfoRevision)
+	return err
+}
@@ -0,0 +1,84 @@
+package archive
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPromote(t *testing.T) {
+	a, err := Open(":memory:", WithVersioning())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for _, text := range []string{"one", "two", "three"} {
+		a.Store(TextPlain("/doc", text))
+	}
+	v, err := a.LoadVersion("/doc", 2)
+	if err != nil {
+		t.Fatalf("expected load version to succeed: %s", err)
+	}
+	if string(v.Data) != "two" {
+		t.Fatalf("expected %q but got %q", "two", v.Data)
+	}
+
+	if err := a.Promote("/doc", 1); err != nil {
+		t.Fatalf("expected promote to succeed: %s", err)
+	}
+	if rev := a.Revision(); rev != 4 {
+		t.Fatalf("expected revision to be %d but was %d", 4, rev)
+	}
+	res, _ := a.Load("/doc")
+	if string(res.Data) != "one" {
+		t.Fatalf("expected %q but got %q", "one", res.Data)
+	}
+	if v, err := a.LoadVersion("/doc", 4); err != nil || string(v.Data) != "one" {
+		t.Fatalf("expected promoted version to be recorded: %q %v", v.Data, err)
+	}
+
+	if err := a.Promote("/doc", 99); err == nil {
+		t.Fatalf("expected promote of missing version to fail")
+	}
+	if rev := a.Revision(); rev != 4 {
+		t.Fatalf("expected revision to stay %d but was %d", 4, rev)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	a, err := Open(":memory:", WithVersioning())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/doc", "one"))
+	a.Store(TextPlain("/other", "other"))
+	a.Store(TextPlain("/doc", "two"))
+	a.Delete("/doc")
+	a.Store(TextPlain("/doc", "three"))
+
+	revisions, err := a.History("/doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 3, 4, 5}; !reflect.DeepEqual(want, revisions) {
+		t.Fatalf("expected %v but got %v", want, revisions)
+	}
+	if _, err := a.LoadVersion("/doc", 4); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v for the tombstone but got %v", ErrNotFound, err)
+	}
+	if err := a.Promote("/doc", 4); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v promoting the tombstone but got %v", ErrNotFound, err)
+	}
+	if v, err := a.LoadVersion("/doc", 3); err != nil || string(v.Data) != "two" {
+		t.Fatalf("expected %q but got %q (%v)", "two", v.Data, err)
+	}
+	if res, err := a.Load("/doc"); err != nil || string(res.Data) != "three" {
+		t.Fatalf("expected %q but got %q (%v)", "three", res.Data, err)
+	}
+	if revisions, _ := a.History("/missing"); len(revisions) != 0 {
+		t.Fatalf("expected no history but got %v", revisions)
+	}
+}
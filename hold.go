@@ -0,0 +1,56 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Retain places a hold on a resource, which makes Delete fail with ErrInUse
+// until every hold has been released with ReleaseHold.
+func (a *Archive) Retain(id string) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		ok, err := exists(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return sql.ErrNoRows
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO HOLDS (ID, COUNT) VALUES (?, 1) ON CONFLICT (ID) DO UPDATE SET COUNT = COUNT + 1;`, id)
+		return err
+	})
+}
+
+// ReleaseHold releases a hold placed with Retain. Releasing a resource
+// without holds has no effect.
+func (a *Archive) ReleaseHold(id string) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `UPDATE HOLDS SET COUNT = COUNT - 1 WHERE ID = ?;`, id); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `DELETE FROM HOLDS WHERE ID = ? AND COUNT <= 0;`, id)
+		return err
+	})
+}
+
+// checkHolds returns ErrInUse if a resource is held.
+func checkHolds(ctx context.Context, tx *sql.Tx, id string) error {
+	var n int
+	err := tx.QueryRowContext(ctx, `SELECT COUNT FROM HOLDS WHERE ID = ?;`, id).Scan(&n)
+	switch {
+	case err == sql.ErrNoRows:
+		return nil
+	case err != nil:
+		return err
+	case n > 0:
+		return fmt.Errorf("%w: %s has %d holds", ErrInUse, id, n)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package archive
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestRetain(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/shared", "shared"))
+	a.Retain("/shared")
+	a.Retain("/shared")
+
+	if err := a.Delete("/shared"); !errors.Is(err, ErrInUse) {
+		t.Fatalf("expected %v but got %v", ErrInUse, err)
+	}
+	if err := a.Batch(func(b *Batch) error { return b.Delete("/shared") }); !errors.Is(err, ErrInUse) {
+		t.Fatalf("expected %v in batch but got %v", ErrInUse, err)
+	}
+	a.ReleaseHold("/shared")
+	if err := a.Delete("/shared"); !errors.Is(err, ErrInUse) {
+		t.Fatalf("expected %v while a hold remains but got %v", ErrInUse, err)
+	}
+	a.ReleaseHold("/shared")
+	if err := a.Delete("/shared"); err != nil {
+		t.Fatalf("expected delete to succeed: %s", err)
+	}
+	if _, err := a.Load("/shared"); err != sql.ErrNoRows {
+		t.Fatalf("expected %v but got %v", sql.ErrNoRows, err)
+	}
+
+	if err := a.Retain("/missing"); err != sql.ErrNoRows {
+		t.Fatalf("expected %v but got %v", sql.ErrNoRows, err)
+	}
+
+	a.Store(TextPlain("/forced", "forced"))
+	a.Retain("/forced")
+	if err := a.ForceDelete("/forced"); err != nil {
+		t.Fatalf("expected forced delete to succeed: %s", err)
+	}
+	a.Store(TextPlain("/forced", "again"))
+	if err := a.Delete("/forced"); err != nil {
+		t.Fatalf("expected holds to be cleared with the resource: %s", err)
+	}
+}
@@ -0,0 +1,544 @@
+package archive
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handler serves the resources of an archive over HTTP, using the request
+// path as the resource ID.
+//
+// If no resource exists for a path, the handler negotiates between its
+// variants (see StoreVariant), such as "/doc.json" and "/doc.xml" for "/doc",
+// choosing by the request's Accept header.
+//
+// Resources of type TypeRedirect are served as a redirect to their Location
+// attribute, using the status in their Status attribute or 302 Found.
+//
+// Data stored compressed is served as is, with a Content-Encoding header, to
+// clients that accept its encoding and decompressed for all others.
+//
+// With the query parameter download=1 resources are served as attachments,
+// named after their Filename attribute.
+//
+// Paths ending in a slash that name no resource are served the Index
+// resource below them or, with Listing, a generated listing of what lies
+// below them. With the query parameter list=1 any path is served the JSON
+// encoded descriptors of the resources whose IDs start with it.
+//
+// Responses carry the ETag and Last-Modified attributes of resources as
+// headers and the handler answers conditional requests with If-None-Match
+// and If-Modified-Since headers by 304 Not Modified where they apply.
+//
+// With Writable, PUT stores the request body taking the attributes from the
+// request headers, see AttributesFromHeader, and DELETE deletes resources.
+// A PUT with an If-Match header only succeeds if the ETag of the stored
+// resource matches, see StoreIfMatch.
+//
+// Request paths are cleaned before they are used as IDs: repeated slashes and
+// "." segments are removed, and paths with ".." segments are rejected with
+// 400 Bad Request. With Prefix, IDs outside of it are not found.
+//
+// With StaleWhileRevalidate, resources with an Expires attribute are served
+// with a matching Cache-Control header. Once expired they are still served
+// for that long, marked stale, while Revalidate is asked to refresh them;
+// after that they are not found. Without it, resources are served regardless
+// of their expiry.
+type Handler struct {
+	Archive *Archive
+	// Index is the name of the resource served for directory paths. It
+	// defaults to DefaultIndex.
+	Index string
+	// Listing enables generated listings for directory paths without an
+	// Index resource.
+	Listing bool
+	// Writable enables PUT and DELETE requests.
+	Writable bool
+	// Prefix, if not empty, restricts the handler to the resources whose IDs
+	// are Prefix or lie below it, such as "/static/a.txt" for "/static" but not
+	// "/statics".
+	Prefix string
+	// StaleWhileRevalidate is how long expired resources are served stale.
+	StaleWhileRevalidate time.Duration
+	// Revalidate, if not nil, is called in a goroutine of its own with the ID
+	// of a stale resource that was served, at most once at a time per ID.
+	Revalidate func(id string)
+
+	revalidating sync.Map
+}
+
+// DefaultIndex is the Index of handlers that do not set one.
+const DefaultIndex = "index.html"
+
+func NewHandler(a *Archive) *Handler {
+	return &Handler{Archive: a}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := cleanPath(r.URL.Path)
+	if !ok {
+		http.Error(w, "invalid path "+r.URL.Path, http.StatusBadRequest)
+		return
+	}
+	if !h.inPrefix(id) {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("list") == "1":
+		h.serveList(w, r, id)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		h.serveGet(w, r, id)
+	case r.Method == http.MethodPut && h.Writable:
+		h.servePut(w, r, id)
+	case r.Method == http.MethodDelete && h.Writable:
+		h.serveDelete(w, r, id)
+	default:
+		if h.Writable {
+			w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		} else {
+			w.Header().Set("Allow", "GET, HEAD")
+		}
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// inPrefix reports whether id is Prefix or lies below it.
+func (h *Handler) inPrefix(id string) bool {
+	prefix := strings.TrimSuffix(h.Prefix, "/")
+	return prefix == "" || id == prefix || strings.HasPrefix(id, prefix+"/")
+}
+
+// cleanPath returns the ID for the request path p, which keeps a trailing
+// slash, or false if p contains a ".." segment.
+func cleanPath(p string) (string, bool) {
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", false
+		}
+	}
+	id := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && id != "/" {
+		id += "/"
+	}
+	return id, true
+}
+
+func (h *Handler) serveList(w http.ResponseWriter, r *http.Request, id string) {
+	ds, err := h.Archive.ListWithPrefixContext(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bs, err := json.Marshal(ds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", TypeApplicationJSON)
+	w.Header().Set("Content-Length", strconv.Itoa(len(bs)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(bs)
+}
+
+func (h *Handler) servePut(w http.ResponseWriter, r *http.Request, id string) {
+	if enc := r.Header.Get("Content-Encoding"); enc != "" && enc != EncodingIdentity {
+		http.Error(w, "unsupported content encoding "+enc, http.StatusUnsupportedMediaType)
+		return
+	}
+	existed, err := h.Archive.Exists(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	as := AttributesFromHeader(r.Header)
+	for _, k := range []string{AttributeEncoding, AttributeLength, AttributeETag, AttributeLastModified} {
+		as.Delete(k)
+	}
+	if match := r.Header.Get("If-Match"); match != "" {
+		data, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			err = h.Archive.StoreIfMatch(MakeResource(id, as, data), match)
+		}
+		h.written(w, err, existed)
+		return
+	}
+	h.written(w, h.Archive.StoreReader(id, as, r.Body), existed)
+}
+
+func (h *Handler) serveDelete(w http.ResponseWriter, r *http.Request, id string) {
+	ok, err := h.Archive.Exists(id)
+	if err == nil && !ok {
+		err = sql.ErrNoRows
+	}
+	if err == nil {
+		err = h.Archive.DeleteContext(r.Context(), id)
+	}
+	h.written(w, err, true)
+}
+
+// written answers a request that changed the resource, which is reported as
+// created unless it existed.
+func (h *Handler) written(w http.ResponseWriter, err error, existed bool) {
+	switch {
+	case err == nil && existed:
+		w.WriteHeader(http.StatusNoContent)
+	case err == nil:
+		w.WriteHeader(http.StatusCreated)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+	case errors.Is(err, ErrReadOnly):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, ErrAttributesTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrETagMismatch):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+	case errors.Is(err, ErrInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, ErrUnsupportedType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, ErrQuotaExceeded):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) serveGet(w http.ResponseWriter, r *http.Request, id string) {
+	res, enc, err := h.load(w, r, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		res, enc, err = h.negotiate(w, r, id)
+	}
+	if errors.Is(err, sql.ErrNoRows) && strings.HasSuffix(id, "/") {
+		res, enc, err = h.load(w, r, id+h.index())
+		if errors.Is(err, sql.ErrNoRows) && h.Listing {
+			err = h.serveListing(w, r, id)
+			if err == nil {
+				return
+			}
+		}
+	}
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, errNotAcceptable):
+		http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.serveResource(w, r, res, enc)
+}
+
+func (h *Handler) index() string {
+	if h.Index == "" {
+		return DefaultIndex
+	}
+	return h.Index
+}
+
+// serveListing serves an HTML listing of the files and directories directly
+// below the directory path id. It returns sql.ErrNoRows if there are none.
+func (h *Handler) serveListing(w http.ResponseWriter, r *http.Request, id string) error {
+	name := strings.Trim(id, "/")
+	if name == "" {
+		name = "."
+	}
+	entries, err := archiveFS{a: h.Archive}.entries(name)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return sql.ErrNoRows
+	}
+	buf := &bytes.Buffer{}
+	title := html.EscapeString("Index of " + id)
+	fmt.Fprintf(buf, "<!DOCTYPE html>\n<title>%s</title>\n<h1>%s</h1>\n<ul>\n", title, title)
+	for _, e := range entries {
+		n := e.Name()
+		if e.IsDir() {
+			n += "/"
+		}
+		u := url.URL{Path: n}
+		fmt.Fprintf(buf, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(u.String()), html.EscapeString(n))
+	}
+	buf.WriteString("</ul>\n")
+	w.Header().Set("Content-Type", TypeTextHTML+"; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(buf.Bytes())
+	}
+	return nil
+}
+
+// load loads a resource, leaving its data compressed if the client accepts
+// the encoding it is stored in. It returns that encoding, or "" if the data
+// is not encoded. For HEAD requests only the attributes of stored resources
+// are loaded.
+func (h *Handler) load(w http.ResponseWriter, r *http.Request, id string) (Resource, string, error) {
+	if _, ok := h.Archive.derivation(id); ok {
+		res, err := h.Archive.LoadContext(r.Context(), id)
+		return res, "", err
+	}
+	var res Resource
+	var err error
+	if r.Method == http.MethodHead {
+		res.ID = id
+		res.Attributes, err = h.Archive.Attributes(id)
+	} else {
+		res, err = h.Archive.loadStoredContext(r.Context(), id)
+	}
+	if err != nil {
+		return Resource{}, "", err
+	}
+	if h.Archive.access != nil {
+		if err := h.Archive.countAccess(id); err != nil {
+			return Resource{}, "", err
+		}
+	}
+	enc := res.Attributes[AttributeEncoding]
+	if enc == "" || enc == EncodingIdentity {
+		return res, "", nil
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if acceptsEncoding(r.Header.Get("Accept-Encoding"), enc) {
+		return res, enc, nil
+	}
+	if r.Method == http.MethodHead {
+		return res, "", nil
+	}
+	res.Data, err = decode(res.Attributes, res.Data)
+	return res, "", err
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header admits enc.
+func acceptsEncoding(header, enc string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		coding, q := strings.TrimSpace(part), 1.0
+		if i := strings.Index(coding, ";"); i >= 0 {
+			if v := strings.TrimSpace(coding[i+1:]); strings.HasPrefix(v, "q=") {
+				if f, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = f
+				}
+			}
+			coding = strings.TrimSpace(coding[:i])
+		}
+		switch {
+		case strings.EqualFold(coding, enc):
+			return q > 0
+		case coding == "*":
+			wildcard = q > 0
+		}
+	}
+	return wildcard
+}
+
+func (h *Handler) serveResource(w http.ResponseWriter, r *http.Request, res Resource, enc string) {
+	if res.Attributes.MediaType() == TypeRedirect {
+		serveRedirect(w, r, res.Attributes)
+		return
+	}
+	if h.StaleWhileRevalidate > 0 && !h.cacheControl(w, res) {
+		http.NotFound(w, r)
+		return
+	}
+	header := res.Attributes.Header()
+	for _, k := range []string{"ETag", "Last-Modified", "Expires"} {
+		if v := header.Get(k); v != "" {
+			w.Header().Set(k, v)
+		}
+	}
+	if etag := w.Header().Get("ETag"); enc != "" && etag != "" && !strings.HasPrefix(etag, "W/") {
+		// the ETag is that of the decoded data
+		w.Header().Set("ETag", "W/"+etag)
+	}
+	if notModified(r, res.Attributes) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if t := res.Attributes[AttributeType]; t != "" {
+		w.Header().Set("Content-Type", t)
+	}
+	if enc != "" {
+		w.Header().Set("Content-Encoding", enc)
+	}
+	if r.Method != http.MethodHead || res.Data != nil {
+		w.Header().Set("Content-Length", strconv.Itoa(len(res.Data)))
+	} else if l := res.Attributes[AttributeLength]; l != "" && enc == "" {
+		// the Length attribute is that of the decoded data
+		w.Header().Set("Content-Length", l)
+	}
+	if r.URL.Query().Get("download") == "1" {
+		params := map[string]string{}
+		if name := res.Attributes.Filename(); name != "" {
+			params["filename"] = name
+		}
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", params))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(res.Data)
+	}
+}
+
+// cacheControl sets the Cache-Control header for a resource according to its
+// Expires attribute and StaleWhileRevalidate, triggering a revalidation if
+// it is stale. It reports false if the resource expired too long ago to be
+// served.
+func (h *Handler) cacheControl(w http.ResponseWriter, res Resource) bool {
+	expires, err := time.Parse(time.RFC3339, res.Attributes[AttributeExpires])
+	if err != nil {
+		return true
+	}
+	swr := int64(h.StaleWhileRevalidate / time.Second)
+	left := expires.Sub(h.Archive.now())
+	if left > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, stale-while-revalidate=%d", int64(left/time.Second), swr))
+		return true
+	}
+	if -left >= h.StaleWhileRevalidate {
+		return false
+	}
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=0, stale-while-revalidate=%d", swr))
+	w.Header().Add("Warning", `110 - "Response is Stale"`)
+	if h.Revalidate != nil {
+		if _, busy := h.revalidating.LoadOrStore(res.ID, true); !busy {
+			go func() {
+				defer h.revalidating.Delete(res.ID)
+				h.Revalidate(res.ID)
+			}()
+		}
+	}
+	return true
+}
+
+// notModified reports whether the conditional headers of r are satisfied by
+// the resource with the attributes as, with If-None-Match taking precedence
+// over If-Modified-Since.
+func notModified(r *http.Request, as Attributes) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := as[AttributeETag]
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	t := modified(as)
+	return !t.IsZero() && !t.Truncate(time.Second).After(ims)
+}
+
+func serveRedirect(w http.ResponseWriter, r *http.Request, as Attributes) {
+	status, err := strconv.Atoi(as[AttributeStatus])
+	if err != nil || status < 300 || status > 399 {
+		status = http.StatusFound
+	}
+	http.Redirect(w, r, as[AttributeLocation], status)
+}
+
+var errNotAcceptable = errors.New("archive: no acceptable variant")
+
+func (h *Handler) negotiate(w http.ResponseWriter, r *http.Request, id string) (Resource, string, error) {
+	ds, err := h.Archive.variants(id)
+	if err != nil {
+		return Resource{}, "", err
+	}
+	if len(ds) == 0 {
+		return Resource{}, "", sql.ErrNoRows
+	}
+	accept := parseAccept(r.Header.Get("Accept"))
+	best, bestQ := "", 0.0
+	for _, d := range ds {
+		if q := accept.quality(d.Attributes[AttributeType]); q > bestQ {
+			best, bestQ = d.ID, q
+		}
+	}
+	w.Header().Add("Vary", "Accept")
+	if best == "" {
+		return Resource{}, "", errNotAcceptable
+	}
+	return h.load(w, r, best)
+}
+
+type mediaRange struct {
+	typ string
+	q   float64
+}
+
+type acceptHeader []mediaRange
+
+func parseAccept(header string) acceptHeader {
+	if strings.TrimSpace(header) == "" {
+		return acceptHeader{{typ: "*/*", q: 1}}
+	}
+	var ranges acceptHeader
+	for _, part := range strings.Split(header, ",") {
+		typ, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		ranges = append(ranges, mediaRange{typ: typ, q: q})
+	}
+	return ranges
+}
+
+// quality returns the quality the header assigns to the content type t,
+// taken from the most specific matching media range.
+func (ah acceptHeader) quality(t string) float64 {
+	typ, _, err := mime.ParseMediaType(t)
+	if err != nil {
+		typ = "application/octet-stream"
+	}
+	major := typ
+	if i := strings.Index(typ, "/"); i >= 0 {
+		major = typ[:i]
+	}
+	q, specificity := 0.0, -1
+	for _, mr := range ah {
+		s := -1
+		switch {
+		case mr.typ == typ:
+			s = 2
+		case mr.typ == major+"/*":
+			s = 1
+		case mr.typ == "*/*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+	return q
+}
@@ -0,0 +1,420 @@
+package archive
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type structuredDoc struct {
+	XMLName xml.Name `json:"-" xml:"doc"`
+	Title   string   `json:"title" xml:"title"`
+}
+
+func TestHandlerNegotiatesStructured(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.StoreStructured("/doc", structuredDoc{Title: "Hello"}); err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+	if rev := a.Revision(); rev != 1 {
+		t.Fatalf("expected revision to be %d but was %d", 1, rev)
+	}
+
+	tests := []struct {
+		name   string
+		accept string
+		status int
+		typ    string
+		body   string
+	}{
+		{name: "json", accept: "application/json", status: http.StatusOK, typ: TypeApplicationJSON, body: `{"title":"Hello"}`},
+		{name: "xml", accept: "application/xml", status: http.StatusOK, typ: TypeApplicationXML, body: "<doc>\n  <title>Hello</title>\n</doc>"},
+		{name: "weighted", accept: "application/json;q=0.5, application/*;q=0.9", status: http.StatusOK, typ: TypeApplicationXML},
+		{name: "any", accept: "", status: http.StatusOK, typ: TypeApplicationJSON},
+		{name: "none", accept: "image/png", status: http.StatusNotAcceptable},
+	}
+	h := NewHandler(a)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/doc", nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != test.status {
+				t.Fatalf("expected status %d but got %d", test.status, rec.Code)
+			}
+			if test.typ != "" && rec.Header().Get("Content-Type") != test.typ {
+				t.Errorf("expected content type %q but got %q", test.typ, rec.Header().Get("Content-Type"))
+			}
+			if test.body != "" && strings.TrimSpace(rec.Body.String()) != test.body {
+				t.Errorf("expected body:\n%s\ngot:\n%s", test.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerNotFound(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	rec := httptest.NewRecorder()
+	NewHandler(a).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d but got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestHandlerPaths(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/static/a.txt", "a"))
+	a.Store(TextPlain("/secret", "secret"))
+	a.Store(TextPlain("/statics", "secret"))
+
+	h := &Handler{Archive: a}
+	tests := []struct {
+		url    string
+		status int
+	}{
+		{url: "/static/a.txt", status: http.StatusOK},
+		{url: "/static//a.txt", status: http.StatusOK},
+		{url: "/static/./a.txt", status: http.StatusOK},
+		{url: "/static/../secret", status: http.StatusBadRequest},
+		{url: "/static/%2e%2e/secret", status: http.StatusBadRequest},
+		{url: "/secret", status: http.StatusNotFound},
+		{url: "/secret?list=1", status: http.StatusNotFound},
+		{url: "/statics", status: http.StatusNotFound},
+		{url: "/statics?list=1", status: http.StatusNotFound},
+	}
+	for _, prefix := range []string{"/static/", "/static"} {
+		h.Prefix = prefix
+		for _, test := range tests {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, test.url, nil))
+			if rec.Code != test.status {
+				t.Fatalf("expected status %d for %s with prefix %s but got %d", test.status, test.url, prefix, rec.Code)
+			}
+			if rec.Body.String() == "secret" {
+				t.Fatalf("expected %s not to serve the secret with prefix %s", test.url, prefix)
+			}
+		}
+	}
+}
+
+func TestHandlerContentTypeCharset(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	typ := "text/html; charset=iso-8859-1"
+	a.Store(MakeResource("/page", Attributes{AttributeType: typ}, []byte("<p>caf\xe9</p>")))
+	rec := httptest.NewRecorder()
+	NewHandler(a).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/page", nil))
+	if got := rec.Header().Get("Content-Type"); got != typ {
+		t.Fatalf("expected content type %q but got %q", typ, got)
+	}
+}
+
+func TestHandlerRedirects(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(Redirect("/old", "/new", http.StatusMovedPermanently))
+	a.Store(Redirect("/elsewhere", "https://example.com/", 0))
+
+	tests := []struct {
+		path     string
+		status   int
+		location string
+	}{
+		{path: "/old", status: http.StatusMovedPermanently, location: "/new"},
+		{path: "/elsewhere", status: http.StatusFound, location: "https://example.com/"},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewHandler(a).ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+			if w.Code != test.status {
+				t.Fatalf("expected status %d but got %d", test.status, w.Code)
+			}
+			if got := w.Header().Get("Location"); got != test.location {
+				t.Fatalf("expected location %q but got %q", test.location, got)
+			}
+		})
+	}
+}
+
+func TestHandlerDownload(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(MakeResource("/report", Attributes{AttributeType: TypeApplicationPDF, AttributeFilename: "report 2020.pdf"}, []byte("%PDF")))
+
+	tests := []struct {
+		url         string
+		disposition string
+	}{
+		{url: "/report", disposition: ""},
+		{url: "/report?download=1", disposition: `attachment; filename="report 2020.pdf"`},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			NewHandler(a).ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.url, nil))
+			if got := w.Header().Get("Content-Disposition"); got != test.disposition {
+				t.Fatalf("expected disposition %q but got %q", test.disposition, got)
+			}
+		})
+	}
+}
+
+func TestHandlerDirectories(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(MakeResource("/site/index.html", Attributes{AttributeType: TypeTextHTML}, []byte("<h1>Home</h1>")))
+	a.Store(MakeResource("/site/docs/home.htm", Attributes{AttributeType: TypeTextHTML}, []byte("<h1>Docs</h1>")))
+	a.Store(TextPlain("/site/docs/a b.txt", "a"))
+	a.Store(TextPlain("/site/docs/img/logo.txt", "logo"))
+
+	tests := []struct {
+		name    string
+		handler *Handler
+		url     string
+		status  int
+		body    string
+	}{
+		{name: "index", handler: NewHandler(a), url: "/site/", status: http.StatusOK, body: "<h1>Home</h1>"},
+		{name: "no index", handler: NewHandler(a), url: "/site/docs/", status: http.StatusNotFound},
+		{name: "custom index", handler: &Handler{Archive: a, Index: "home.htm"}, url: "/site/docs/", status: http.StatusOK, body: "<h1>Docs</h1>"},
+		{name: "listing", handler: &Handler{Archive: a, Listing: true}, url: "/site/docs/", status: http.StatusOK, body: "<!DOCTYPE html>\n<title>Index of /site/docs/</title>\n<h1>Index of /site/docs/</h1>\n<ul>\n<li><a href=\"a%20b.txt\">a b.txt</a></li>\n<li><a href=\"home.htm\">home.htm</a></li>\n<li><a href=\"img/\">img/</a></li>\n</ul>\n"},
+		{name: "empty listing", handler: &Handler{Archive: a, Listing: true}, url: "/none/", status: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			test.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.url, nil))
+			if w.Code != test.status {
+				t.Fatalf("expected status %d but got %d", test.status, w.Code)
+			}
+			if test.body != "" && w.Body.String() != test.body {
+				t.Fatalf("expected body %q but got %q", test.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlerWrites(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	do := func(h *Handler, method, url, body string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, strings.NewReader(body))
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	h := &Handler{Archive: a, Writable: true}
+
+	if w := do(NewHandler(a), http.MethodPut, "/doc", "hello", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d for a read-only handler but got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if w := do(h, http.MethodPut, "/doc", "hello", http.Header{"Content-Type": {"text/plain"}}); w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d but got %d", http.StatusCreated, w.Code)
+	}
+	if res, _ := a.Load("/doc"); string(res.Data) != "hello" || res.Attributes[AttributeType] != "text/plain" {
+		t.Fatalf("expected the body to be stored but got %v", res)
+	}
+
+	head := do(h, http.MethodHead, "/doc", "", nil)
+	etag := head.Header().Get("ETag")
+	if head.Code != http.StatusOK || etag == "" || head.Header().Get("Last-Modified") == "" || head.Body.Len() != 0 {
+		t.Fatalf("expected attribute headers without a body but got %d %v", head.Code, head.Header())
+	}
+	if w := do(h, http.MethodGet, "/doc", "", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		t.Fatalf("expected status %d but got %d", http.StatusNotModified, w.Code)
+	}
+	lastModified := head.Header().Get("Last-Modified")
+	if w := do(h, http.MethodGet, "/doc", "", http.Header{"If-Modified-Since": {lastModified}}); w.Code != http.StatusNotModified {
+		t.Fatalf("expected status %d but got %d", http.StatusNotModified, w.Code)
+	}
+	if w := do(h, http.MethodGet, "/doc", "", http.Header{"If-None-Match": {`"other"`}}); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("expected the resource but got %d %q", w.Code, w.Body.String())
+	}
+
+	if w := do(h, http.MethodPut, "/doc", "stale", http.Header{"If-Match": {`"other"`}}); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected status %d but got %d", http.StatusPreconditionFailed, w.Code)
+	}
+	if w := do(h, http.MethodPut, "/doc", "updated", http.Header{"If-Match": {etag}}); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d but got %d", http.StatusNoContent, w.Code)
+	}
+
+	list := do(h, http.MethodGet, "/?list=1", "", nil)
+	if list.Code != http.StatusOK || !strings.Contains(list.Body.String(), `"ID":"/doc"`) {
+		t.Fatalf("expected a listing of %s but got %d %s", "/doc", list.Code, list.Body.String())
+	}
+
+	if w := do(h, http.MethodDelete, "/doc", "", nil); w.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d but got %d", http.StatusNoContent, w.Code)
+	}
+	if w := do(h, http.MethodDelete, "/doc", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d but got %d", http.StatusNotFound, w.Code)
+	}
+	if w := do(h, http.MethodGet, "/doc", "", nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d but got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestHandlerWriteErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	a, err := Open(file, WithMaxAttributesSize(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	ro, err := Open(file, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+
+	tests := []struct {
+		name   string
+		a      *Archive
+		header http.Header
+		status int
+	}{
+		{name: "read-only", a: ro, status: http.StatusForbidden},
+		{name: "attributes too large", a: a, header: http.Header{"Content-Type": {"text/plain; note=" + strings.Repeat("x", 100)}}, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/doc", strings.NewReader("hello"))
+			for k, v := range test.header {
+				r.Header[k] = v
+			}
+			w := httptest.NewRecorder()
+			(&Handler{Archive: test.a, Writable: true}).ServeHTTP(w, r)
+			if w.Code != test.status {
+				t.Fatalf("expected status %d but got %d", test.status, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandlerHeadSkipsData(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	a, err := Open(file, WithInlineThreshold(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/doc", "hello world"))
+	_, name := splitChecksum(Checksum([]byte("hello world")))
+	os.Remove(filepath.Join(file+".blobs", name))
+
+	w := httptest.NewRecorder()
+	NewHandler(a).ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/doc", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Length") != "11" || w.Header().Get("ETag") == "" {
+		t.Fatalf("expected HEAD to be answered from the attributes but got %d %v", w.Code, w.Header())
+	}
+	w = httptest.NewRecorder()
+	NewHandler(a).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/doc", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected GET to fail without the data but got %d", w.Code)
+	}
+}
+
+func TestHandlerStaleWhileRevalidate(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a, err := Open(":memory:", WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.StoreWithTTL(TextPlain("/feed", "cached"), time.Minute)
+	revalidated := make(chan string, 1)
+	h := &Handler{Archive: a, StaleWhileRevalidate: time.Hour, Revalidate: func(id string) { revalidated <- id }}
+
+	tests := []struct {
+		name         string
+		after        time.Duration
+		status       int
+		cacheControl string
+		warning      string
+	}{
+		{name: "fresh", after: 0, status: http.StatusOK, cacheControl: "max-age=60, stale-while-revalidate=3600"},
+		{name: "stale", after: 2 * time.Minute, status: http.StatusOK, cacheControl: "max-age=0, stale-while-revalidate=3600", warning: `110 - "Response is Stale"`},
+		{name: "too stale", after: 2 * time.Hour, status: http.StatusNotFound},
+	}
+	start := now
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			now = start.Add(test.after)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/feed", nil))
+			if w.Code != test.status {
+				t.Fatalf("expected status %d but got %d", test.status, w.Code)
+			}
+			if got := w.Header().Get("Cache-Control"); got != test.cacheControl {
+				t.Fatalf("expected cache control %q but got %q", test.cacheControl, got)
+			}
+			if got := w.Header().Get("Warning"); got != test.warning {
+				t.Fatalf("expected warning %q but got %q", test.warning, got)
+			}
+		})
+	}
+	select {
+	case id := <-revalidated:
+		if id != "/feed" {
+			t.Fatalf("expected %s to be revalidated but got %s", "/feed", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the stale resource to be revalidated")
+	}
+
+	now = start.Add(2 * time.Hour)
+	w := httptest.NewRecorder()
+	NewHandler(a).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/feed", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "" {
+		t.Fatalf("expected expiry to be ignored without the policy but got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,28 @@
+package archive
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strconv"
+	"strings"
+)
+
+// setImageMetadata sets the Image-Width and Image-Height attributes of a
+// GIF, JPEG or PNG image from the header of its data, or removes them if the
+// header cannot be decoded. Other resources are left alone.
+func setImageMetadata(as Attributes, data []byte) {
+	if !strings.HasPrefix(as.MediaType(), "image/") {
+		return
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		delete(as, AttributeImageWidth)
+		delete(as, AttributeImageHeight)
+		return
+	}
+	as[AttributeImageWidth] = strconv.Itoa(cfg.Width)
+	as[AttributeImageHeight] = strconv.Itoa(cfg.Height)
+}
@@ -0,0 +1,44 @@
+package archive
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func TestImageMetadata(t *testing.T) {
+	a, err := Open(":memory:", WithImageMetadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, image.NewRGBA(image.Rect(0, 0, 40, 30)), nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		id     string
+		typ    string
+		data   []byte
+		width  string
+		height string
+	}{
+		{id: "/photo", typ: TypeImageJPEG, data: buf.Bytes(), width: "40", height: "30"},
+		{id: "/broken", typ: TypeImageJPEG, data: []byte("not an image")},
+		{id: "/text", typ: TypeTextPlain, data: buf.Bytes()},
+	}
+	for _, test := range tests {
+		if err := a.Store(Resource{ID: test.id, Attributes: Attributes{AttributeType: test.typ}, Data: test.data}); err != nil {
+			t.Fatal(err)
+		}
+		as, err := a.Attributes(test.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if as[AttributeImageWidth] != test.width || as[AttributeImageHeight] != test.height {
+			t.Fatalf("expected %s size %sx%s but got %sx%s", test.id, test.width, test.height, as[AttributeImageWidth], as[AttributeImageHeight])
+		}
+	}
+}
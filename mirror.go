@@ -0,0 +1,80 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// A MirrorPolicy decides how a failure to mirror a write is handled.
+type MirrorPolicy int
+
+const (
+	// MirrorBestEffort logs mirror failures and lets the write succeed.
+	MirrorBestEffort MirrorPolicy = iota
+	// MirrorStrict fails the write, which is then rolled back. Since the
+	// mirror commits only after the archive did, failing to commit there
+	// fails the write but cannot roll it back anymore.
+	MirrorStrict
+)
+
+type mirror struct {
+	archive *Archive
+	policy  MirrorPolicy
+}
+
+// stageMirror applies the changes tx made to resources to the mirror, in a
+// transaction of the mirror that is left open to be committed after tx. It
+// returns nil if mirroring failed but the policy lets the write succeed.
+func (a *Archive) stageMirror(ctx context.Context, tx *sql.Tx, changes []Change) (*pending, error) {
+	m := a.mirror.archive
+	p, err := m.prepare(ctx, func(ctx context.Context, mtx *sql.Tx) error {
+		for _, c := range changes {
+			if err := a.replicate(ctx, tx, m, mtx, c.ID); err != nil {
+				return err
+			}
+		}
+		return bumpRevision(ctx, mtx)
+	})
+	if err != nil {
+		return nil, a.mirrorFailed(err)
+	}
+	return p, nil
+}
+
+// replicate gives the resource id in m the state it has in tx.
+func (a *Archive) replicate(ctx context.Context, tx *sql.Tx, m *Archive, mtx *sql.Tx, id string) error {
+	var attributes string
+	var data []byte
+	var external sql.NullString
+	err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES, DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes, &data, &external)
+	if err == sql.ErrNoRows {
+		_, err := m.remove(ctx, mtx, id)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	as, err := ParseAttributes(attributes)
+	if err != nil {
+		return err
+	}
+	if data, err = a.fetch(data, external); err != nil {
+		return err
+	}
+	if data, err = decode(as, data); err != nil {
+		return err
+	}
+	return m.put(ctx, mtx, id, as, data, Checksum(data))
+}
+
+// mirrorFailed handles the error of mirroring a write according to the
+// policy, returning the error to fail the write with, if any.
+func (a *Archive) mirrorFailed(err error) error {
+	if a.mirror.policy == MirrorStrict {
+		return fmt.Errorf("archive: mirror: %w", err)
+	}
+	log.Printf("archive: mirror: %v", err)
+	return nil
+}
@@ -0,0 +1,188 @@
+package archive
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithMirror(t *testing.T) {
+	secondary, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secondary.Close()
+	a, err := Open(":memory:", WithMirror(secondary, MirrorStrict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.Store(TextPlain("/", "foo")); err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+	for _, x := range []*Archive{a, secondary} {
+		if r, err := x.Load("/"); err != nil || string(r.Data) != "foo" {
+			t.Fatalf("expected both archives to have the resource: %v %v", r, err)
+		}
+	}
+	if err := a.Delete("/"); err != nil {
+		t.Fatalf("expected delete to succeed: %s", err)
+	}
+	if _, err := secondary.Load("/"); err != sql.ErrNoRows {
+		t.Fatalf("expected delete to be mirrored but got %v", err)
+	}
+}
+
+func TestMirrorFailure(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	tests := []struct {
+		name   string
+		policy MirrorPolicy
+		err    error
+	}{
+		{name: "best effort", policy: MirrorBestEffort},
+		{name: "strict", policy: MirrorStrict, err: ErrClosed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			secondary, _ := Open(":memory:")
+			secondary.Close()
+			a, err := Open(":memory:", WithMirror(secondary, test.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer a.Close()
+
+			err = a.Store(TextPlain("/", "foo"))
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v but got %v", test.err, err)
+			}
+			if _, lerr := a.Load("/"); (lerr == nil) != (err == nil) {
+				t.Fatalf("expected the write to be kept only if it succeeded: %v", lerr)
+			}
+		})
+	}
+}
+
+func TestMirrorAsyncWrites(t *testing.T) {
+	secondary, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secondary.Close()
+	a, err := Open(":memory:", WithAsyncWrites(10, nil), WithMirror(secondary, MirrorStrict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "a"))
+	a.Store(TextPlain("/b", "b"))
+	if err := a.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"/a", "/b"} {
+		if r, err := secondary.Load(id); err != nil || string(r.Data) != id[1:] {
+			t.Fatalf("expected %s to be mirrored but got %v %v", id, r, err)
+		}
+	}
+}
+
+func TestMirrorAllWrites(t *testing.T) {
+	secondary, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer secondary.Close()
+	a, err := Open(":memory:", WithVersioning(), WithMirror(secondary, MirrorStrict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	pack, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pack.Close()
+	pack.Store(TextPlain("/packed", "packed"))
+	buf := &bytes.Buffer{}
+	if err := pack.ExportPack(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := OpenPack(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.Store(TextPlain("/a", "v1"))
+	a.Store(TextPlain("/a", "v2"))
+	a.StoreWithTTL(TextPlain("/expired", "expired"), -time.Hour)
+	a.Store(TextPlain("/evicted", "evicted"))
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"Pin", func() error { return a.Pin("/a") }},
+		{"ApplyAttributes", func() error {
+			_, err := a.ApplyAttributes(strings.NewReader(`{"/a": {"Label": "applied"}}`))
+			return err
+		}},
+		{"RetypeAll", func() error {
+			_, err := a.RetypeAll(func(id string, data []byte) string { return "text/x-retyped" })
+			return err
+		}},
+		{"Promote", func() error { return a.Promote("/a", 1) }},
+		{"ImportPack", func() error {
+			_, err := a.ImportPack(p, ConflictOverwrite)
+			return err
+		}},
+		{"Finalize", func() error {
+			if err := a.WriteAt("/upload", 0, []byte("uploaded")); err != nil {
+				return err
+			}
+			return a.Finalize("/upload")
+		}},
+		{"PurgeExpired", func() error {
+			_, err := a.PurgeExpired()
+			return err
+		}},
+		{"Unpin", func() error { return a.Unpin("/a") }},
+		{"EvictToSize", func() error {
+			a.Pin("/a")
+			a.Pin("/packed")
+			a.Pin("/upload")
+			_, err := a.EvictToSize(0)
+			return err
+		}},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("expected %s to succeed: %s", step.name, err)
+		}
+		ds, _ := a.List()
+		ms, _ := secondary.List()
+		if len(ds) != len(ms) {
+			t.Fatalf("expected %s to mirror %d resources but got %d", step.name, len(ds), len(ms))
+		}
+		for _, d := range ds {
+			want, _ := a.Load(d.ID)
+			got, err := secondary.Load(d.ID)
+			if err != nil || !got.Equal(want) {
+				t.Fatalf("expected %s to mirror %v but got %v %v", step.name, want, got, err)
+			}
+		}
+	}
+	if ok, _ := secondary.Exists("/evicted"); ok {
+		t.Fatalf("expected the eviction to be mirrored")
+	}
+}
@@ -0,0 +1,50 @@
+package archive
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+)
+
+// WriteMultipart writes the resources ids to w as the parts of a
+// multipart/mixed body, each with the Type of its resource as Content-Type
+// and its ID as Content-ID, and returns the content type of the body. The
+// resources are loaded one at a time while writing. If w is an
+// http.ResponseWriter, its Content-Type header is set before anything is
+// written.
+func (a *Archive) WriteMultipart(w io.Writer, ids []string) (contentType string, err error) {
+	mw := multipart.NewWriter(w)
+	contentType = "multipart/mixed; boundary=" + mw.Boundary()
+	if rw, ok := w.(http.ResponseWriter); ok {
+		rw.Header().Set("Content-Type", contentType)
+	}
+	for _, id := range ids {
+		if err := a.writePart(mw, id); err != nil {
+			return "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return "", err
+	}
+	return contentType, nil
+}
+
+func (a *Archive) writePart(mw *multipart.Writer, id string) error {
+	r, as, err := a.LoadStream(id)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	header := textproto.MIMEHeader{}
+	if t := as[AttributeType]; t != "" {
+		header.Set("Content-Type", t)
+	}
+	header.Set("Content-ID", "<"+id+">")
+	pw, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(pw, r)
+	return err
+}
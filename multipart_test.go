@@ -0,0 +1,57 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"reflect"
+	"testing"
+)
+
+func TestWriteMultipart(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "alpha"))
+	a.Store(JPEG("/b", []byte("jpeg")))
+
+	buf := &bytes.Buffer{}
+	contentType, err := a.WriteMultipart(buf, []string{"/b", "/a"})
+	if err != nil {
+		t.Fatalf("expected write to succeed: %s", err)
+	}
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mt != "multipart/mixed" {
+		t.Fatalf("expected a multipart/mixed content type but got %q", contentType)
+	}
+	type part struct{ id, typ, data string }
+	var got []part
+	mr := multipart.NewReader(buf, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(p)
+		got = append(got, part{p.Header.Get("Content-ID"), p.Header.Get("Content-Type"), string(data)})
+	}
+	want := []part{
+		{"</b>", TypeImageJPEG, "jpeg"},
+		{"</a>", TypeTextPlain, "alpha"},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+
+	if _, err := a.WriteMultipart(ioutil.Discard, []string{"/a", "/missing"}); err == nil {
+		t.Fatalf("expected a missing resource to fail the write")
+	}
+}
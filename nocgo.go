@@ -0,0 +1,16 @@
+//go:build !cgo
+// +build !cgo
+
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+const cgoEnabled = false
+
+func backup(ctx context.Context, dst, src *sql.DB) error {
+	return fmt.Errorf("%w: the backup API requires cgo", ErrDriverUnavailable)
+}
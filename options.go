@@ -0,0 +1,255 @@
+package archive
+
+import "time"
+
+type Option func(*Archive)
+
+// WithDefaultTimeout bounds every database operation by d. Operations that
+// exceed it fail with ErrTimeout.
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(a *Archive) {
+		a.timeout = d
+	}
+}
+
+// WithDriver selects the name of the registered database/sql driver used to
+// open the archive. It defaults to DefaultDriver.
+func WithDriver(name string) Option {
+	return func(a *Archive) {
+		a.driver = name
+	}
+}
+
+// WithClock replaces the source of the current time, e.g. to control time
+// valued attributes such as Last-Modified in tests.
+func WithClock(now func() time.Time) Option {
+	return func(a *Archive) {
+		a.clock = now
+	}
+}
+
+// WithVersioning keeps every stored version of a resource, keyed by the
+// revision that stored it, so that it can be loaded or promoted later.
+func WithVersioning() Option {
+	return func(a *Archive) {
+		a.versioning = true
+	}
+}
+
+// WithCompression compresses the data of new writes at the given level
+// whenever that makes it smaller, using gzip unless WithCompressionEncoding
+// selects another codec. Load always returns the original data.
+func WithCompression(level int) Option {
+	return func(a *Archive) {
+		a.compress = true
+		a.compression = level
+	}
+}
+
+// WithTypeSniffer replaces the detector used to determine the content type
+// of imported data whose file extension is unknown. It defaults to
+// DetectType.
+func WithTypeSniffer(s TypeSniffer) Option {
+	return func(a *Archive) {
+		a.sniffer = s
+	}
+}
+
+// WithOctetStreamDefault makes imported data whose content type can be
+// determined neither from its file extension nor by the TypeSniffer
+// application/octet-stream instead of leaving its Type unset.
+func WithOctetStreamDefault() Option {
+	return func(a *Archive) {
+		a.octetStreamDefault = true
+	}
+}
+
+// WithVacuumOnShutdown makes Shutdown vacuum the database before closing it.
+func WithVacuumOnShutdown() Option {
+	return func(a *Archive) {
+		a.vacuumOnShutdown = true
+	}
+}
+
+// WithCreationTime makes the archive record the time a resource was first
+// stored in its Created attribute, which later stores leave untouched.
+func WithCreationTime() Option {
+	return func(a *Archive) {
+		a.creationTime = true
+	}
+}
+
+// WithPageSize sets the database page size in bytes, a power of two between
+// 512 and 65536. It only takes effect when the archive is created or after it
+// has been vacuumed.
+func WithPageSize(bytes int) Option {
+	return func(a *Archive) {
+		a.pageSize = bytes
+	}
+}
+
+// WithCacheSize sets the page cache size of each database connection. As with
+// PRAGMA cache_size, a positive value counts pages and a negative value
+// counts kibibytes.
+func WithCacheSize(n int) Option {
+	return func(a *Archive) {
+		a.cacheSize = n
+	}
+}
+
+// WithAllowedTypes restricts the types of stored resources to the given media
+// types, which may be wildcards such as "image/*". Storing any other resource,
+// including one without a type, fails with ErrUnsupportedType.
+func WithAllowedTypes(types ...string) Option {
+	return func(a *Archive) {
+		a.allowedTypes = append([]string{}, types...)
+	}
+}
+
+// WithMaxAttributesSize limits the attributes of a stored resource to size
+// bytes, counting the lengths of all keys and values, including the ones the
+// archive sets itself such as Checksum and Last-Modified. Storing or updating
+// a resource with larger attributes fails with ErrAttributesTooLarge. A size
+// of 0, the default, means no limit.
+func WithMaxAttributesSize(size int) Option {
+	return func(a *Archive) {
+		a.maxAttributesSize = size
+	}
+}
+
+// WithImageMetadata sets the Image-Width and Image-Height attributes of GIF,
+// JPEG and PNG images on store, decoding only the header of their data. The
+// attributes are removed from images whose header cannot be decoded, and
+// other resources are stored unchanged.
+func WithImageMetadata() Option {
+	return func(a *Archive) {
+		a.imageMetadata = true
+	}
+}
+
+// WithSingleConnection serializes all database access over a single
+// connection, trading throughput for freedom from lock contention between
+// connections.
+func WithSingleConnection() Option {
+	return func(a *Archive) {
+		a.singleConnection = true
+	}
+}
+
+// WithReaders serves the reads outside of transactions, such as Load, List
+// and Attributes, from a pool of up to n read-only connections, so that they
+// run concurrently with each other and with writes. It puts the database into
+// WAL mode, which persists. In-memory archives ignore the option.
+func WithReaders(n int) Option {
+	return func(a *Archive) {
+		a.readers = n
+	}
+}
+
+// WithEncryptionKey encrypts the data of resources and their versions with
+// AES-GCM using key, which must be 16, 24 or 32 bytes long for AES-128,
+// AES-192 or AES-256. Attributes are not encrypted. Data that cannot be
+// decrypted with key, because it was tampered with, fails to load with
+// ErrAuthenticationFailed. Once encrypted, an archive fails to open with
+// ErrEncrypted without a key and with ErrAuthenticationFailed with another
+// one. Archives whose data is stored unencrypted cannot be opened with a key.
+func WithEncryptionKey(key []byte) Option {
+	return func(a *Archive) {
+		a.encryptionKey = append([]byte{}, key...)
+	}
+}
+
+// WithDeltaVersions stores each version of a resource recorded by
+// WithVersioning as a binary delta against its previous version whenever the
+// delta is smaller, and reconstructs it exactly on LoadVersion. At most 16
+// deltas are chained before a version is stored in full again. Deltas are
+// computed on the stored data, so they help little with WithCompression.
+func WithDeltaVersions() Option {
+	return func(a *Archive) {
+		a.deltaVersions = true
+	}
+}
+
+// WithCompressionEncoding selects the codec used by WithCompression, such as
+// EncodingBrotli. It defaults to EncodingGZIP.
+func WithCompressionEncoding(encoding string) Option {
+	return func(a *Archive) {
+		a.encoding = encoding
+	}
+}
+
+// WithReadOnly opens the database file read-only, so that archives on
+// read-only file systems can be opened, and makes every method that would
+// change the archive fail with ErrReadOnly. The schema of the file is used as
+// it is, so it must have been written by an archive of this version. Access
+// counting is disabled. Files that never change can additionally be opened
+// with "?immutable=1" in the dsn, which skips SQLite's locking. In-memory
+// archives are only protected from changes.
+func WithReadOnly() Option {
+	return func(a *Archive) {
+		a.readOnly = true
+	}
+}
+
+// WithAccessCounting counts how often each resource is loaded. Counts are
+// collected in memory and written after every batch loads, on
+// FlushAccessCounts and on Close.
+func WithAccessCounting(batch int) Option {
+	return func(a *Archive) {
+		if batch < 1 {
+			batch = 1
+		}
+		a.access = &accessCounter{batch: batch, pending: map[string]int64{}}
+	}
+}
+
+// WithMirror applies every change to the resources of the archive to
+// secondary as well, which commits it right after the archive did, handling
+// failures there according to policy.
+func WithMirror(secondary *Archive, policy MirrorPolicy) Option {
+	return func(a *Archive) {
+		a.mirror = &mirror{archive: secondary, policy: policy}
+	}
+}
+
+// WithActor records actor in the Last-Modified-By attribute of writes whose
+// context carries no actor of its own.
+func WithActor(actor string) Option {
+	return func(a *Archive) {
+		a.actor = actor
+	}
+}
+
+// WithAsyncWrites makes Store queue resources and return immediately, while a
+// background goroutine commits them in batches of up to batch resources.
+// Every other write waits for the queued resources to be committed first, so
+// that it applies after them. Flush and Close wait for queued resources to be
+// committed. Errors are passed to onError, if not nil, and returned by the
+// next Flush.
+func WithAsyncWrites(batch int, onError func(error)) Option {
+	return func(a *Archive) {
+		if batch < 1 {
+			batch = 1
+		}
+		a.queue = newWriteQueue(batch, onError)
+	}
+}
+
+// WithInlineThreshold keeps data that is stored larger than threshold bytes
+// in files next to the database instead of in the database itself. Existing
+// resources are moved to match the threshold when the archive is opened, and
+// a threshold of 0, the default, moves all data back into the database.
+// In-memory archives always keep their data inline.
+func WithInlineThreshold(threshold int64) Option {
+	return func(a *Archive) {
+		a.inlineThreshold = threshold
+	}
+}
+
+// WithColdTier sets the archive holding the data of the resources tiered by
+// Tier, which is needed to load them after the archive is reopened.
+func WithColdTier(cold *Archive) Option {
+	return func(a *Archive) {
+		a.cold = cold
+	}
+}
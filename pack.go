@@ -0,0 +1,296 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// A pack is a read-only, self-describing snapshot of an archive, laid out
+// for random access:
+//
+//	magic      [8]byte "ARCPACK1"
+//	indexLen   uint64
+//	index      entries sorted by ID, each
+//	             idLen uint32, id, attributesLen uint32, attributes,
+//	             offset uint64, length int64 (-1 for no data)
+//	payloads   the concatenated data as stored, i.e. compressed if the
+//	           attributes say so, offsets relative to its start
+const packMagic = "ARCPACK1"
+
+type packEntry struct {
+	id         string
+	attributes string
+	offset     int64
+	length     int64
+}
+
+type ExportOption func(*exportConfig)
+
+type exportConfig struct {
+	verify  bool
+	corrupt *[]string
+}
+
+// ExportVerify makes an export verify each resource before anything is
+// written and fail with ErrChecksumMismatch on the first one that does not
+// verify, leaving w untouched.
+func ExportVerify() ExportOption {
+	return func(c *exportConfig) {
+		c.verify = true
+	}
+}
+
+// ExportCollectCorrupt makes an export verify each resource before anything
+// is written and append the IDs of those that do not verify to ids,
+// exporting them nonetheless.
+func ExportCollectCorrupt(ids *[]string) ExportOption {
+	return func(c *exportConfig) {
+		c.verify = true
+		c.corrupt = ids
+	}
+}
+
+// ExportPack writes a pack of all resources to w.
+func (a *Archive) ExportPack(w io.Writer, opts ...ExportOption) error {
+	c := exportConfig{}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	ctx, cancel := a.context()
+	defer cancel()
+	err := transact(ctx, a.db, func(tx *sql.Tx) error {
+		es, err := a.packEntries(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if c.verify {
+			for _, e := range es {
+				data, err := a.packData(ctx, tx, e.id)
+				if err != nil {
+					return err
+				}
+				as, _ := ParseAttributes(e.attributes)
+				if err := verify(e.id, as, data); err != nil {
+					if c.corrupt == nil {
+						return err
+					}
+					*c.corrupt = append(*c.corrupt, e.id)
+				}
+			}
+		}
+		index := &bytes.Buffer{}
+		for _, e := range es {
+			writePackString(index, e.id)
+			writePackString(index, e.attributes)
+			binary.Write(index, binary.BigEndian, uint64(e.offset))
+			binary.Write(index, binary.BigEndian, e.length)
+		}
+
+		bw := bufio.NewWriter(w)
+		bw.WriteString(packMagic)
+		binary.Write(bw, binary.BigEndian, uint64(index.Len()))
+		if _, err := bw.Write(index.Bytes()); err != nil {
+			return err
+		}
+		for _, e := range es {
+			if e.length <= 0 {
+				continue
+			}
+			data, err := a.packData(ctx, tx, e.id)
+			if err != nil {
+				return err
+			}
+			if _, err := bw.Write(data); err != nil {
+				return err
+			}
+		}
+		return bw.Flush()
+	})
+	return a.translate(ctx, err)
+}
+
+// packData returns the data of the resource id as it is written to a pack.
+func (a *Archive) packData(ctx context.Context, tx *sql.Tx, id string) ([]byte, error) {
+	var data []byte
+	var external sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&data, &external); err != nil {
+		return nil, err
+	}
+	return a.fetch(data, external)
+}
+
+func (a *Archive) packEntries(ctx context.Context, tx *sql.Tx) ([]packEntry, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT ID, ATTRIBUTES, IFNULL(LENGTH(DATA), -1), EXTERNAL FROM RESOURCES ORDER BY ID;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var es []packEntry
+	var offset int64
+	for rows.Next() {
+		e := packEntry{offset: offset}
+		var external sql.NullString
+		if err := rows.Scan(&e.id, &e.attributes, &e.length, &external); err != nil {
+			return nil, err
+		}
+		_, isTiered := tiered(external)
+		if external.Valid {
+			n, err := a.externalSize(external)
+			if err != nil {
+				return nil, err
+			}
+			e.length = n
+		}
+		if e.length > 0 && !isTiered {
+			// the data is written opened
+			e.length -= a.sealOverhead()
+		}
+		if e.length > 0 {
+			offset += e.length
+		}
+		es = append(es, e)
+	}
+	return es, rows.Err()
+}
+
+func writePackString(buf *bytes.Buffer, s string) {
+	binary.Write(buf, binary.BigEndian, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+type PackReader struct {
+	ra      io.ReaderAt
+	base    int64
+	entries []packEntry
+}
+
+// OpenPack reads the index of a pack written by ExportPack. The payloads are
+// read from ra on demand.
+func OpenPack(ra io.ReaderAt) (*PackReader, error) {
+	header := make([]byte, len(packMagic)+8)
+	if _, err := ra.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("archive: invalid pack header: %w", err)
+	}
+	if string(header[:len(packMagic)]) != packMagic {
+		return nil, fmt.Errorf("archive: invalid pack header")
+	}
+	indexLen := int64(binary.BigEndian.Uint64(header[len(packMagic):]))
+	r := bufio.NewReader(io.NewSectionReader(ra, int64(len(header)), indexLen))
+	p := &PackReader{ra: ra, base: int64(len(header)) + indexLen}
+	for {
+		id, err := readPackString(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archive: invalid pack index: %w", err)
+		}
+		e := packEntry{id: id}
+		var offset uint64
+		if e.attributes, err = readPackString(r); err == nil {
+			if err = binary.Read(r, binary.BigEndian, &offset); err == nil {
+				err = binary.Read(r, binary.BigEndian, &e.length)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archive: invalid pack index: %w", err)
+		}
+		e.offset = int64(offset)
+		p.entries = append(p.entries, e)
+	}
+	return p, nil
+}
+
+func readPackString(r io.Reader) (string, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func (p *PackReader) List() ([]Descriptor, error) {
+	ds := make([]Descriptor, 0, len(p.entries))
+	for _, e := range p.entries {
+		as, err := ParseAttributes(e.attributes)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, Descriptor{ID: e.id, Attributes: as})
+	}
+	return ds, nil
+}
+
+// Load looks up id in the index and reads its data with a single ranged
+// read. Like Archive.Load it returns sql.ErrNoRows for missing resources.
+func (p *PackReader) Load(id string) (Resource, error) {
+	i := sort.Search(len(p.entries), func(i int) bool { return p.entries[i].id >= id })
+	if i == len(p.entries) || p.entries[i].id != id {
+		return Resource{}, sql.ErrNoRows
+	}
+	e := p.entries[i]
+	as, err := ParseAttributes(e.attributes)
+	if err != nil {
+		return Resource{}, err
+	}
+	var data []byte
+	if e.length >= 0 {
+		data = make([]byte, e.length)
+		if _, err := p.ra.ReadAt(data, p.base+e.offset); err != nil && !(err == io.EOF && e.length == 0) {
+			return Resource{}, err
+		}
+	}
+	if data, err = decode(as, data); err != nil {
+		return Resource{}, err
+	}
+	return MakeResource(id, as, data), nil
+}
+
+// ImportPack stores the resources of p in a single transaction, resolving
+// collisions with existing resources according to policy. It returns the
+// number of resources stored.
+func (a *Archive) ImportPack(p *PackReader, policy ConflictPolicy) (int, error) {
+	if err := a.writable(); err != nil {
+		return 0, err
+	}
+	n := 0
+	err := a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		// the resources are read one at a time, so that only one is held in
+		// memory
+		for _, e := range p.entries {
+			r, err := p.Load(e.id)
+			if err != nil {
+				return err
+			}
+			ok, err := policy.resolve(ctx, tx, r.ID, r.Attributes)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			if err := a.put(ctx, tx, r.ID, r.Attributes, r.Data, Checksum(r.Data)); err != nil {
+				return err
+			}
+			n++
+		}
+		if n > 0 {
+			return bumpRevision(ctx, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,156 @@
+package archive
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPackRoundTrip(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	rs := []Resource{
+		TextPlain("/a", "alpha"),
+		MakeResource("/b", Attributes{AttributeType: TypeImagePNG}, []byte{0, 1, 2, 3}),
+		MakeResource("/c", Attributes{}, []byte{}),
+		MakeResource("/d", Attributes{AttributeLabel: "no data"}, nil),
+		TextPlain("/e", "epsilon"),
+	}
+	for _, r := range rs {
+		a.Store(r)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := a.ExportPack(buf); err != nil {
+		t.Fatalf("expected export to succeed: %s", err)
+	}
+	p, err := OpenPack(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("expected open to succeed: %s", err)
+	}
+	ds, _ := p.List()
+	if len(ds) != len(rs) {
+		t.Fatalf("expected %d entries but got %d", len(rs), len(ds))
+	}
+	for _, r := range rs {
+		want, _ := a.Load(r.ID)
+		got, err := p.Load(r.ID)
+		if err != nil {
+			t.Fatalf("expected load of %s to succeed: %s", r.ID, err)
+		}
+		if !got.StrictEqual(want) || (got.Data == nil) != (want.Data == nil) {
+			t.Errorf("expected %#v but got %#v", want, got)
+		}
+	}
+	if _, err := p.Load("/missing"); err != sql.ErrNoRows {
+		t.Fatalf("expected %v but got %v", sql.ErrNoRows, err)
+	}
+	if _, err := OpenPack(bytes.NewReader([]byte("not a pack at all"))); err == nil {
+		t.Fatalf("expected invalid pack to fail")
+	}
+}
+
+func TestImportPackConflicts(t *testing.T) {
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	clock := WithClock(func() time.Time { return now })
+	src, err := Open(":memory:", clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	for _, id := range []string{"/fresh", "/new", "/old"} {
+		src.Store(TextPlain(id, "src"))
+	}
+	buf := &bytes.Buffer{}
+	src.ExportPack(buf)
+	p, err := OpenPack(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		policy ConflictPolicy
+		n      int
+		err    error
+		want   map[string]string
+	}{
+		{name: "overwrite", policy: ConflictOverwrite, n: 3, want: map[string]string{"/fresh": "src", "/new": "src", "/old": "src"}},
+		{name: "skip", policy: ConflictSkip, n: 1, want: map[string]string{"/fresh": "src", "/new": "dst", "/old": "dst"}},
+		{name: "newer wins", policy: ConflictNewerWins, n: 2, want: map[string]string{"/fresh": "src", "/new": "dst", "/old": "src"}},
+		{name: "error", policy: ConflictError, err: ErrConflict, want: map[string]string{"/fresh": "", "/new": "dst", "/old": "dst"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst, err := Open(":memory:", clock)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer dst.Close()
+			now = time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC)
+			dst.Store(TextPlain("/old", "dst"))
+			now = time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC)
+			dst.Store(TextPlain("/new", "dst"))
+
+			n, err := dst.ImportPack(p, test.policy)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected error %v but got %v", test.err, err)
+			}
+			if n != test.n {
+				t.Fatalf("expected %d imported resources but got %d", test.n, n)
+			}
+			for id, data := range test.want {
+				r, _ := dst.Load(id)
+				if string(r.Data) != data {
+					t.Fatalf("expected %q for %s but got %q", data, id, r.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestExportPackVerify(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "alpha"))
+	a.Store(TextPlain("/b", "bravo"))
+	a.Store(MakeResource("/c", Attributes{}, nil))
+	// an index larger than the write buffer of the export
+	a.Store(MakeResource("/d", Attributes{"Note": strings.Repeat("x", 8<<10)}, []byte("delta")))
+	a.db.Exec(`UPDATE RESOURCES SET DATA = ? WHERE ID = ?;`, []byte("bogus"), "/b")
+
+	out := &bytes.Buffer{}
+	if err := a.ExportPack(out, ExportVerify()); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected %v but got %v", ErrChecksumMismatch, err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("expected nothing to be written but got %d bytes", out.Len())
+	}
+
+	var corrupt []string
+	buf := &bytes.Buffer{}
+	if err := a.ExportPack(buf, ExportCollectCorrupt(&corrupt)); err != nil {
+		t.Fatalf("expected export to succeed: %s", err)
+	}
+	if len(corrupt) != 1 || corrupt[0] != "/b" {
+		t.Fatalf("expected [/b] to be collected but got %v", corrupt)
+	}
+	p, err := OpenPack(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("expected a readable pack: %s", err)
+	}
+	if r, _ := p.Load("/a"); string(r.Data) != "alpha" {
+		t.Fatalf("expected intact data but got %q", r.Data)
+	}
+}
@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// PatchJSON applies a JSON Merge Patch, as specified by RFC 7386, to a JSON
+// resource and stores the result, all in one transaction. Members of the
+// patch that are null are removed from the resource, objects are merged
+// recursively, and any other value replaces the one in the resource. It fails
+// with ErrNotFound if there is no resource id and with ErrUnsupportedType if
+// its Type is not JSON.
+func (a *Archive) PatchJSON(id string, patch []byte) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	var p interface{}
+	if err := unmarshalJSON(patch, &p); err != nil {
+		return fmt.Errorf("archive: invalid merge patch: %w", err)
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		var attributes string
+		var data []byte
+		var external sql.NullString
+		err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES, DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes, &data, &external)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		as, err := ParseAttributes(attributes)
+		if err != nil {
+			return err
+		}
+		if !isJSON(as.MediaType()) {
+			return fmt.Errorf("%w: %q for %s is not JSON", ErrUnsupportedType, as.MediaType(), id)
+		}
+		if data, err = a.fetch(data, external); err != nil {
+			return err
+		}
+		if data, err = decode(as, data); err != nil {
+			return err
+		}
+		var v interface{}
+		if err := unmarshalJSON(data, &v); err != nil {
+			return fmt.Errorf("archive: %s is not valid JSON: %w", id, err)
+		}
+		if data, err = json.Marshal(mergePatch(v, p)); err != nil {
+			return err
+		}
+		if err := a.put(ctx, tx, id, as, data, Checksum(data)); err != nil {
+			return err
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == TypeApplicationJSON || strings.HasSuffix(mediaType, "+json")
+}
+
+// unmarshalJSON is like json.Unmarshal but keeps numbers as json.Number, so
+// that patching does not change the numbers it leaves alone.
+func unmarshalJSON(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
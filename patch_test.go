@@ -0,0 +1,54 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPatchJSON(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	tests := []struct {
+		name   string
+		stored string
+		patch  string
+		out    string
+	}{
+		{name: "replace", stored: `{"a":"b"}`, patch: `{"a":"c"}`, out: `{"a":"c"}`},
+		{name: "add", stored: `{"a":"b"}`, patch: `{"b":"c"}`, out: `{"a":"b","b":"c"}`},
+		{name: "delete", stored: `{"a":"b","b":"c"}`, patch: `{"a":null}`, out: `{"b":"c"}`},
+		{name: "nested", stored: `{"a":{"b":"c","d":{"e":1}},"f":2}`, patch: `{"a":{"b":null,"d":{"g":3}}}`, out: `{"a":{"d":{"e":1,"g":3}},"f":2}`},
+		{name: "array", stored: `{"a":[1,2]}`, patch: `{"a":[3]}`, out: `{"a":[3]}`},
+		{name: "not-an-object", stored: `["a"]`, patch: `{"a":"b"}`, out: `{"a":"b"}`},
+		{name: "whole", stored: `{"a":"b"}`, patch: `"c"`, out: `"c"`},
+		{name: "precision", stored: `{"n":12345678901234567890}`, patch: `{"m":1}`, out: `{"m":1,"n":12345678901234567890}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id := "/" + test.name
+			a.Store(MakeResource(id, Attributes{AttributeType: TypeApplicationJSON}, []byte(test.stored)))
+			if err := a.PatchJSON(id, []byte(test.patch)); err != nil {
+				t.Fatal(err)
+			}
+			res, err := a.Load(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(res.Data); got != test.out {
+				t.Fatalf("expected %s but got %s", test.out, got)
+			}
+		})
+	}
+
+	a.Store(TextPlain("/text", "{}"))
+	if err := a.PatchJSON("/text", []byte(`{"a":1}`)); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected %v but got %v", ErrUnsupportedType, err)
+	}
+	if err := a.PatchJSON("/missing", []byte(`{"a":1}`)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v but got %v", ErrNotFound, err)
+	}
+}
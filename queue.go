@@ -0,0 +1,162 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// A writeQueue collects resources stored with WithAsyncWrites and commits
+// them in batches from a background goroutine.
+//
+// Queued resources are committed in the order they were stored. A batch is
+// committed in a single transaction; if that fails, its resources are stored
+// one by one so that a single bad resource does not cost the rest of the
+// batch, and the errors of those that still fail are reported. Writes that
+// have not been committed are lost if the process exits before Flush or Close
+// return.
+type writeQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	batch   int
+	onError func(error)
+	pending []Resource
+	busy    bool
+	stopped bool
+	err     error
+	done    chan struct{}
+}
+
+func newWriteQueue(batch int, onError func(error)) *writeQueue {
+	q := &writeQueue{batch: batch, onError: onError, done: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *writeQueue) enqueue(r Resource) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.stopped {
+		return ErrClosed
+	}
+	if r.Data != nil {
+		r.Data = append([]byte{}, r.Data...)
+	}
+	r.Attributes = r.Attributes.Clone()
+	q.pending = append(q.pending, r)
+	q.cond.Broadcast()
+	return nil
+}
+
+// flush waits until every resource queued so far has been committed and
+// returns the first error since the previous flush.
+func (q *writeQueue) flush() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.drain()
+	err := q.err
+	q.err = nil
+	return err
+}
+
+// wait is like flush but leaves the error to the next flush.
+func (q *writeQueue) wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.drain()
+}
+
+func (q *writeQueue) drain() {
+	for len(q.pending) > 0 || q.busy {
+		q.cond.Wait()
+	}
+}
+
+// stop flushes the queue and ends its goroutine.
+func (q *writeQueue) stop() error {
+	err := q.flush()
+	q.mu.Lock()
+	if q.stopped {
+		q.mu.Unlock()
+		return err
+	}
+	q.stopped = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	<-q.done
+	return err
+}
+
+func (a *Archive) runQueue() {
+	q := a.queue
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.stopped {
+			q.cond.Wait()
+		}
+		if len(q.pending) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		n := len(q.pending)
+		if n > q.batch {
+			n = q.batch
+		}
+		rs := append([]Resource{}, q.pending[:n]...)
+		q.pending = q.pending[n:]
+		q.busy = true
+		q.mu.Unlock()
+
+		errs := a.commitQueued(rs)
+		if q.onError != nil {
+			for _, err := range errs {
+				q.onError(err)
+			}
+		}
+
+		q.mu.Lock()
+		q.busy = false
+		if len(errs) > 0 && q.err == nil {
+			q.err = errs[0]
+		}
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}
+}
+
+func (a *Archive) commitQueued(rs []Resource) []error {
+	if err := a.commitBatch(rs); err == nil {
+		return nil
+	}
+	var errs []error
+	for _, r := range rs {
+		if err := a.commitBatch([]Resource{r}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// commitBatch stores rs in a single transaction. Unlike Store, it must not
+// wait for the queue, which is busy with rs.
+func (a *Archive) commitBatch(rs []Resource) error {
+	return a.commit(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		for _, r := range rs {
+			if err := a.put(ctx, tx, r.ID, r.Attributes, r.Data, Checksum(r.Data)); err != nil {
+				return err
+			}
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
+
+// Flush waits until every resource stored so far with WithAsyncWrites has
+// been committed and returns the first error that occurred since the previous
+// Flush. Without WithAsyncWrites it does nothing.
+func (a *Archive) Flush() error {
+	if a.queue == nil {
+		return nil
+	}
+	return a.queue.flush()
+}
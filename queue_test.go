@@ -0,0 +1,126 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAsyncWrites(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	a, err := Open(file, WithAsyncWrites(50, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 500; i++ {
+		if err := a.Store(TextPlain(fmt.Sprintf("/%03d", i), fmt.Sprintf("v%d", i))); err != nil {
+			t.Fatalf("expected enqueue to succeed: %s", err)
+		}
+	}
+	a.Store(TextPlain("/000", "last"))
+	if err := a.Flush(); err != nil {
+		t.Fatalf("expected flush to succeed: %s", err)
+	}
+	ds, _ := a.List()
+	if len(ds) != 500 {
+		t.Fatalf("expected %d resources but got %d", 500, len(ds))
+	}
+	if r, _ := a.Load("/000"); string(r.Data) != "last" {
+		t.Fatalf("expected writes to be applied in order but got %q", r.Data)
+	}
+	if rev := a.Revision(); rev < 10 || rev > 501 {
+		t.Fatalf("expected batched revisions but got %d", rev)
+	}
+
+	a.Store(TextPlain("/closing", "closing"))
+	if err := a.Close(); err != nil {
+		t.Fatalf("expected close to succeed: %s", err)
+	}
+	b, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := b.Load("/closing"); err != nil {
+		t.Fatalf("expected close to commit queued writes: %s", err)
+	}
+}
+
+func TestAsyncWriteErrors(t *testing.T) {
+	var mu sync.Mutex
+	var reported []error
+	a, err := Open(":memory:", WithAllowedTypes(TypeTextPlain), WithAsyncWrites(10, func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/ok", "ok"))
+	a.Store(JPEG("/rejected", nil))
+	a.Store(TextPlain("/also-ok", "ok"))
+	if err := a.Flush(); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected %v but got %v", ErrUnsupportedType, err)
+	}
+	if err := a.Flush(); err != nil {
+		t.Fatalf("expected errors to be reported once but got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reported) != 1 {
+		t.Fatalf("expected %d reported error but got %v", 1, reported)
+	}
+	for _, id := range []string{"/ok", "/also-ok"} {
+		if _, err := a.Load(id); err != nil {
+			t.Fatalf("expected %s to be stored despite the failing batch: %s", id, err)
+		}
+	}
+}
+
+func TestAsyncWritesKeepOrder(t *testing.T) {
+	a, err := Open(":memory:", WithAllowedTypes(TypeTextPlain), WithAsyncWrites(10, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/tee", "queued"))
+	if err := a.StoreTee("/tee", Attributes{AttributeType: TypeTextPlain}, strings.NewReader("direct"), ioutil.Discard); err != nil {
+		t.Fatal(err)
+	}
+	a.Store(TextPlain("/pinned", "queued"))
+	if err := a.Pin("/pinned"); err != nil {
+		t.Fatalf("expected the queued resource to be pinned: %s", err)
+	}
+	a.Store(TextPlain("/from", "queued"))
+	a.Store(TextPlain("/to", "queued"))
+	if err := a.AddEdge("/from", "/to", "link"); err != nil {
+		t.Fatalf("expected an edge between queued resources: %s", err)
+	}
+	a.Store(JPEG("/rejected", nil))
+	a.Store(TextPlain("/written", "queued"))
+	if err := a.WriteAt("/written", 0, []byte("direct")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Flush(); !errors.Is(err, ErrUnsupportedType) {
+		t.Fatalf("expected writes to leave queued errors to Flush but got %v", err)
+	}
+
+	if r, _ := a.Load("/tee"); string(r.Data) != "direct" {
+		t.Fatalf("expected %q but got %q", "direct", r.Data)
+	}
+	if as, _ := a.Attributes("/pinned"); as[AttributePinned] != "true" {
+		t.Fatalf("expected %s to be pinned but got %v", "/pinned", as)
+	}
+	if r, _ := a.Load("/written"); string(r.Data) != "direct" {
+		t.Fatalf("expected %q but got %q", "direct", r.Data)
+	}
+}
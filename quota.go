@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// SetQuota limits the total data length of the resources whose ID starts
+// with prefix to maxBytes. Stores exceeding it fail with ErrQuotaExceeded. A
+// negative maxBytes removes the quota.
+func (a *Archive) SetQuota(prefix string, maxBytes int64) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ctx, cancel := a.context()
+	defer cancel()
+	var err error
+	if maxBytes < 0 {
+		_, err = a.db.ExecContext(ctx, `DELETE FROM QUOTAS WHERE PREFIX = ?;`, prefix)
+	} else {
+		_, err = a.db.ExecContext(ctx, `INSERT OR REPLACE INTO QUOTAS (PREFIX, MAX_BYTES) VALUES (?, ?);`, prefix, maxBytes)
+	}
+	return a.translate(ctx, err)
+}
+
+// checkQuota verifies that replacing the data of id with size bytes keeps
+// every quota covering id.
+func checkQuota(ctx context.Context, tx *sql.Tx, id string, size int64) error {
+	rows, err := tx.QueryContext(ctx, `SELECT PREFIX, MAX_BYTES FROM QUOTAS WHERE SUBSTR(?, 1, LENGTH(PREFIX)) = PREFIX;`, id)
+	if err != nil {
+		return err
+	}
+	type quota struct {
+		prefix string
+		max    int64
+	}
+	var qs []quota
+	for rows.Next() {
+		var q quota
+		if err := rows.Scan(&q.prefix, &q.max); err != nil {
+			rows.Close()
+			return err
+		}
+		qs = append(qs, q)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, q := range qs {
+		var used int64
+		err := tx.QueryRowContext(ctx, `SELECT IFNULL(SUM(SIZE), 0) FROM RESOURCES WHERE SUBSTR(ID, 1, LENGTH(?1)) = ?1 AND ID != ?2;`, q.prefix, id).Scan(&used)
+		if err != nil {
+			return err
+		}
+		if used+size > q.max {
+			return fmt.Errorf("%w: storing %d bytes at %s would use %d of %d bytes under %q", ErrQuotaExceeded, size, id, used+size, q.max, q.prefix)
+		}
+	}
+	return nil
+}
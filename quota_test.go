@@ -0,0 +1,63 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.SetQuota("/t1/", 100); err != nil {
+		t.Fatalf("expected set quota to succeed: %s", err)
+	}
+	if err := a.Store(MakeResource("/t1/a", Attributes{}, make([]byte, 60))); err != nil {
+		t.Fatalf("expected store within quota to succeed: %s", err)
+	}
+	if err := a.Store(MakeResource("/t1/b", Attributes{}, make([]byte, 40))); err != nil {
+		t.Fatalf("expected store up to quota to succeed: %s", err)
+	}
+	rev := a.Revision()
+	if err := a.Store(MakeResource("/t1/c", Attributes{}, make([]byte, 1))); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected %v but got %v", ErrQuotaExceeded, err)
+	}
+	if _, err := a.Load("/t1/c"); err == nil {
+		t.Fatalf("expected rejected resource not to be stored")
+	}
+	if got := a.Revision(); got != rev {
+		t.Fatalf("expected revision to stay %d but was %d", rev, got)
+	}
+	if err := a.Store(MakeResource("/t1/a", Attributes{}, make([]byte, 50))); err != nil {
+		t.Fatalf("expected shrinking replacement to succeed: %s", err)
+	}
+	if err := a.WriteAt("/t1/b", 40, make([]byte, 20)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected %v but got %v", ErrQuotaExceeded, err)
+	}
+	if err := a.Store(MakeResource("/t2/a", Attributes{}, make([]byte, 1000))); err != nil {
+		t.Fatalf("expected store outside quota to succeed: %s", err)
+	}
+	a.SetQuota("/t1/", -1)
+	if err := a.Store(MakeResource("/t1/c", Attributes{}, make([]byte, 1000))); err != nil {
+		t.Fatalf("expected store to succeed without quota: %s", err)
+	}
+}
+
+func TestQuotaMultiBytePrefix(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.SetQuota("/müller/", 100)
+	if err := a.Store(MakeResource("/müller/a", Attributes{}, make([]byte, 60))); err != nil {
+		t.Fatalf("expected store within quota to succeed: %s", err)
+	}
+	if err := a.Store(MakeResource("/müller/b", Attributes{}, make([]byte, 60))); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected %v but got %v", ErrQuotaExceeded, err)
+	}
+}
@@ -0,0 +1,44 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+)
+
+// openReaders opens the pool of read-only connections of WithReaders. The
+// database is switched to WAL mode, in which readers do not wait for the
+// writer and see every transaction committed before they started.
+func (a *Archive) openReaders(ctx context.Context, db *sql.DB) error {
+	if a.readers <= 0 || isMemory(a.dsn) {
+		return nil
+	}
+	// the journal mode of read-only files cannot be changed, and readers work
+	// in either mode
+	if !a.readOnly {
+		if _, err := db.ExecContext(ctx, `PRAGMA journal_mode = WAL;`); err != nil {
+			return err
+		}
+	}
+	pragmas := append(a.pragmas(), `PRAGMA query_only = ON;`)
+	rdb := sql.OpenDB(pragmaConnector{driver: db.Driver(), dsn: a.dsn, pragmas: pragmas})
+	rdb.SetMaxOpenConns(a.readers)
+	rdb.SetMaxIdleConns(a.readers)
+	a.rdb = rdb
+	return nil
+}
+
+// reader returns the database to run queries outside of transactions on.
+func (a *Archive) reader() *sql.DB {
+	if a.rdb != nil {
+		return a.rdb
+	}
+	return a.db
+}
+
+// closeReaders closes the pool of WithReaders, if any.
+func (a *Archive) closeReaders() error {
+	if a.rdb == nil {
+		return nil
+	}
+	return a.rdb.Close()
+}
@@ -0,0 +1,112 @@
+package archive
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithReaders(t *testing.T) {
+	a, err := Open(filepath.Join(t.TempDir(), "archive.db"), WithReaders(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				id := fmt.Sprintf("/%d/%d", w, i)
+				if err := a.Store(TextPlain(id, id)); err != nil {
+					t.Error(err)
+					return
+				}
+				res, err := a.Load(id)
+				if err != nil || string(res.Data) != id {
+					t.Errorf("expected %q but got %q (%v)", id, res.Data, err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if n, _ := a.Count(); n != 80 {
+		t.Fatalf("expected %d resources but got %d", 80, n)
+	}
+	if _, err := a.reader().Exec(`DELETE FROM RESOURCES;`); err == nil {
+		t.Fatalf("expected the readers to be read-only")
+	}
+}
+
+func TestWithReadersServeScans(t *testing.T) {
+	a, err := Open(filepath.Join(t.TempDir(), "archive.db"), WithSingleConnection(), WithReaders(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	a.Store(TextPlain("/t/a", "a"))
+
+	// hold the only connection for writes, so that only the readers can
+	// answer
+	tx, err := a.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	done := make(chan error, 1)
+	go func() {
+		if _, err := a.VerifyAllParallel(2); err != nil {
+			done <- err
+			return
+		}
+		if _, err := a.AggregateByAttribute(AttributeType); err != nil {
+			done <- err
+			return
+		}
+		if _, err := a.TenantUsage("/"); err != nil {
+			done <- err
+			return
+		}
+		_, err := a.AttributeKeys()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the scans to be served by the readers")
+	}
+}
+
+func BenchmarkLoadParallel(b *testing.B) {
+	for _, readers := range []int{0, 8} {
+		b.Run(fmt.Sprintf("readers=%d", readers), func(b *testing.B) {
+			a, err := Open(filepath.Join(b.TempDir(), "archive.db"), WithSingleConnection(), WithReaders(readers))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer a.Close()
+			for i := 0; i < 100; i++ {
+				a.Store(TextPlain(fmt.Sprintf("/%d", i), "data"))
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, err := a.Load(fmt.Sprintf("/%d", i%100)); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package archive
+
+import "strings"
+
+// writable returns ErrReadOnly for archives opened WithReadOnly.
+func (a *Archive) writable() error {
+	if a.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// readOnlyDSN returns dsn as a URI that asks SQLite to open the database
+// file read-only. In-memory databases are left alone.
+func readOnlyDSN(dsn string) string {
+	if isMemory(dsn) {
+		return dsn
+	}
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&mode=ro"
+	}
+	return dsn + "?mode=ro"
+}
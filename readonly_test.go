@@ -0,0 +1,51 @@
+package archive
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	a, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.Store(TextPlain("/a", "a"))
+	a.Close()
+
+	r, err := Open(file, WithReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if res, err := r.Load("/a"); err != nil || string(res.Data) != "a" {
+		t.Fatalf("expected %q but got %q (%v)", "a", res.Data, err)
+	}
+	writes := map[string]func() error{
+		"Store":  func() error { return r.Store(TextPlain("/b", "b")) },
+		"Delete": func() error { return r.Delete("/a") },
+		"Rename": func() error { return r.Rename("/a", "/b") },
+		"Pin":    func() error { return r.Pin("/a") },
+		"Purge": func() error {
+			_, err := r.PurgeExpired()
+			return err
+		},
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("expected %s to fail with %v but got %v", name, ErrReadOnly, err)
+		}
+	}
+	if _, err := r.DB().Exec(`DELETE FROM RESOURCES;`); err == nil {
+		t.Fatalf("expected the database to refuse writes")
+	}
+	if ok, _ := r.Exists("/a"); !ok {
+		t.Fatalf("expected /a to be untouched")
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.db"), WithReadOnly()); err == nil {
+		t.Fatalf("expected opening a missing file read-only to fail")
+	}
+}
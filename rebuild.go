@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Rebuild replaces the resources and the change log of dst with those of the
+// archive and sets the revision of dst to that of the archive, so that dst
+// can continue to sync incrementally from Changes where the archive is.
+// Resources are copied one at a time, as they are stored, from a consistent
+// snapshot of the archive; tiered resources are copied with their data.
+// Other state of dst, such as versions, is left alone, and the watchers and
+// mirror of dst are not told about the rebuild.
+func (a *Archive) Rebuild(dst *Archive) error {
+	if dst == nil || dst == a {
+		return fmt.Errorf("archive: invalid rebuild destination")
+	}
+	if err := dst.writable(); err != nil {
+		return err
+	}
+	if dst.queue != nil {
+		dst.queue.wait()
+	}
+	dst.mu.Lock()
+	defer dst.mu.Unlock()
+	ctx, cancel := a.context()
+	defer cancel()
+	err := transact(ctx, a.db, func(src *sql.Tx) error {
+		var revision int
+		if err := src.QueryRowContext(ctx, `SELECT VALUE FROM INFO WHERE NAME = ?;`, InfoRevision).Scan(&revision); err != nil {
+			return err
+		}
+		return transact(ctx, dst.db, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM RESOURCES;`); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM CHANGES;`); err != nil {
+				return err
+			}
+			rows, err := src.QueryContext(ctx, `SELECT ID, ATTRIBUTES, DATA, EXTERNAL FROM RESOURCES ORDER BY ID;`)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var id, attributes string
+				var data []byte
+				var external sql.NullString
+				if err := rows.Scan(&id, &attributes, &data, &external); err != nil {
+					return err
+				}
+				if err := a.rebuildResource(ctx, tx, dst, id, attributes, data, external); err != nil {
+					return err
+				}
+			}
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			changes, err := src.QueryContext(ctx, `SELECT REVISION, ID, OP FROM CHANGES;`)
+			if err != nil {
+				return err
+			}
+			defer changes.Close()
+			for changes.Next() {
+				var rev int
+				var id, op string
+				if err := changes.Scan(&rev, &id, &op); err != nil {
+					return err
+				}
+				if _, err := tx.ExecContext(ctx, `INSERT INTO CHANGES (REVISION, ID, OP) VALUES (?, ?, ?);`, rev, id, op); err != nil {
+					return err
+				}
+			}
+			if err := changes.Err(); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `UPDATE INFO SET VALUE = ? WHERE NAME = ?;`, revision, InfoRevision)
+			return err
+		})
+	})
+	return a.translate(ctx, err)
+}
+
+// rebuildResource writes the resource id, read from a row of the archive, to
+// dst with tx.
+func (a *Archive) rebuildResource(ctx context.Context, tx *sql.Tx, dst *Archive, id, attributes string, data []byte, external sql.NullString) error {
+	as, err := ParseAttributes(attributes)
+	if err != nil {
+		return err
+	}
+	stored, err := a.fetch(data, external)
+	if err != nil {
+		return err
+	}
+	sealed, err := dst.seal(stored)
+	if err != nil {
+		return err
+	}
+	inline, ext, err := dst.externalize(sealed)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO RESOURCES (ID, ATTRIBUTES, DATA, SIZE, MODIFIED, EXTERNAL) VALUES (?, ?, ?, ?, ?, ?);`, id, attributes, inline, len(stored), as[AttributeLastModified], ext)
+	return err
+}
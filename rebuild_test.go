@@ -0,0 +1,55 @@
+package archive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRebuild(t *testing.T) {
+	src, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	src.Store(TextPlain("/a", "a"))
+	src.StoreBatch([]Resource{TextPlain("/b", "b"), TextPlain("/c", "c")})
+	src.Delete("/a")
+	dst.Store(TextPlain("/stale", "stale"))
+
+	if err := src.Rebuild(dst); err != nil {
+		t.Fatal(err)
+	}
+	if src.Revision() != dst.Revision() {
+		t.Fatalf("expected revision %d but got %d", src.Revision(), dst.Revision())
+	}
+	want, _ := src.Changes(0)
+	if got, _ := dst.Changes(0); !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected changes %v but got %v", want, got)
+	}
+	ds, _ := dst.List()
+	if len(ds) != 2 || ds[0].ID != "/b" || ds[1].ID != "/c" {
+		t.Fatalf("expected /b and /c but got %v", ds)
+	}
+	for _, id := range []string{"/b", "/c"} {
+		w, _ := src.Load(id)
+		g, err := dst.Load(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(w, g) {
+			t.Fatalf("expected %v but got %v", w, g)
+		}
+	}
+
+	src.Store(TextPlain("/d", "d"))
+	synced := dst.Revision()
+	if cs, _ := src.Changes(synced); len(cs) != 1 || cs[0].ID != "/d" {
+		t.Fatalf("expected the change of /d after revision %d but got %v", synced, cs)
+	}
+}
@@ -0,0 +1,67 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Rename changes the ID of a resource without touching its data, carrying
+// over its edges, access count and holds. It fails with ErrNotFound if there
+// is no resource oldID and with ErrConflict if there already is one newID.
+// The history of the resource, see WithVersioning, stays with oldID.
+func (a *Archive) Rename(oldID, newID string) error {
+	return a.rename(oldID, newID, false)
+}
+
+// Move is like Rename but replaces a resource newID, unless it is held.
+func (a *Archive) Move(oldID, newID string) error {
+	return a.rename(oldID, newID, true)
+}
+
+func (a *Archive) rename(oldID, newID string, overwrite bool) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		if ok, err := exists(ctx, tx, oldID); err != nil {
+			return err
+		} else if !ok {
+			return ErrNotFound
+		}
+		if oldID == newID {
+			return nil
+		}
+		if ok, err := exists(ctx, tx, newID); err != nil {
+			return err
+		} else if ok {
+			if !overwrite {
+				return fmt.Errorf("%w: %s", ErrConflict, newID)
+			}
+			if err := checkHolds(ctx, tx, newID); err != nil {
+				return err
+			}
+			if _, err := a.remove(ctx, tx, newID); err != nil {
+				return err
+			}
+		}
+		for _, stmt := range []string{
+			`UPDATE RESOURCES SET ID = ? WHERE ID = ?;`,
+			`UPDATE EDGES SET FROM_ID = ? WHERE FROM_ID = ?;`,
+			`UPDATE EDGES SET TO_ID = ? WHERE TO_ID = ?;`,
+			`UPDATE ACCESS SET ID = ? WHERE ID = ?;`,
+			`UPDATE HOLDS SET ID = ? WHERE ID = ?;`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt, newID, oldID); err != nil {
+				return err
+			}
+		}
+		if err := recordChange(ctx, tx, oldID, changeDeleted); err != nil {
+			return err
+		}
+		if err := recordChange(ctx, tx, newID, changeStored); err != nil {
+			return err
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
@@ -0,0 +1,57 @@
+package archive
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRename(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/old", "content"))
+	a.Store(TextPlain("/taken", "other"))
+	a.Store(TextPlain("/index", "index"))
+	a.AddEdge("/index", "/old", "links")
+	rev := a.Revision()
+
+	if err := a.Rename("/old", "/taken"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected %v but got %v", ErrConflict, err)
+	}
+	if err := a.Rename("/missing", "/new"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected %v but got %v", ErrNotFound, err)
+	}
+	if got := a.Revision(); got != rev {
+		t.Fatalf("expected revision %d but got %d", rev, got)
+	}
+
+	if err := a.Rename("/old", "/new"); err != nil {
+		t.Fatalf("expected rename to succeed: %s", err)
+	}
+	if got := a.Revision(); got != rev+1 {
+		t.Fatalf("expected revision %d but got %d", rev+1, got)
+	}
+	if ok, _ := a.Exists("/old"); ok {
+		t.Fatalf("expected %s to be gone", "/old")
+	}
+	if res, _ := a.Load("/new"); string(res.Data) != "content" {
+		t.Fatalf("expected %q but got %q", "content", res.Data)
+	}
+	if got, _ := a.Edges("/index", "links"); !reflect.DeepEqual([]string{"/new"}, got) {
+		t.Fatalf("expected the edge to follow the rename but got %v", got)
+	}
+
+	if err := a.Move("/new", "/taken"); err != nil {
+		t.Fatalf("expected move to succeed: %s", err)
+	}
+	if res, _ := a.Load("/taken"); string(res.Data) != "content" {
+		t.Fatalf("expected %q but got %q", "content", res.Data)
+	}
+	if n, _ := a.Count(); n != 2 {
+		t.Fatalf("expected %d resources but got %d", 2, n)
+	}
+}
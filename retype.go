@@ -0,0 +1,64 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+)
+
+// RetypeAll corrects the Type attributes of all resources. It loads the
+// resources one at a time and passes their IDs and decoded data to detect,
+// which returns the correct type, or "" to leave the type alone. The changed
+// Type attributes are then updated in a single transaction without rewriting
+// any data, and their number is returned.
+func (a *Archive) RetypeAll(detect func(id string, data []byte) string) (int, error) {
+	if err := a.writable(); err != nil {
+		return 0, err
+	}
+	ds, err := a.List()
+	if err != nil {
+		return 0, err
+	}
+	types := map[string]string{}
+	for _, d := range ds {
+		res, err := a.loadStoredContext(context.Background(), d.ID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		data, err := decode(res.Attributes, res.Data)
+		if err != nil {
+			return 0, err
+		}
+		if typ := detect(d.ID, data); typ != "" && typ != res.Attributes[AttributeType] {
+			types[d.ID] = typ
+		}
+	}
+	if len(types) == 0 {
+		return 0, nil
+	}
+
+	n := 0
+	err = a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		for id, typ := range types {
+			ok, err := a.updateAttributes(ctx, tx, id, func(as Attributes) {
+				as[AttributeType] = typ
+			})
+			if err != nil {
+				return err
+			}
+			if ok {
+				n++
+			}
+		}
+		if n > 0 {
+			return bumpRevision(ctx, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,48 @@
+package archive
+
+import (
+	"mime"
+	"net/http"
+	"testing"
+)
+
+func TestRetypeAll(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(MakeResource("/page", Attributes{AttributeType: TypeTextPlain}, []byte("<!DOCTYPE html><html></html>")))
+	a.Store(MakeResource("/png", Attributes{AttributeType: TypeImageJPEG}, []byte("\x89PNG\r\n\x1a\n")))
+	a.Store(TextPlain("/text", "just text"))
+	a.Store(MakeResource("/skipped", Attributes{AttributeType: TypeTextPlain}, []byte("<html></html>")))
+	rev := a.Revision()
+
+	n, err := a.RetypeAll(func(id string, data []byte) string {
+		if id == "/skipped" {
+			return ""
+		}
+		typ, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+		return typ
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected %d retyped resources but got %d", 2, n)
+	}
+	if got := a.Revision(); got != rev+1 {
+		t.Fatalf("expected revision %d but got %d", rev+1, got)
+	}
+	for id, want := range map[string]string{
+		"/page":    TypeTextHTML,
+		"/png":     TypeImagePNG,
+		"/text":    TypeTextPlain,
+		"/skipped": TypeTextPlain,
+	} {
+		if as, _ := a.Attributes(id); as[AttributeType] != want {
+			t.Errorf("expected %s to have type %q but got %q", id, want, as[AttributeType])
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// LoadJSONValidated is like LoadJSON but first validates the data against the
+// JSON Schema named by the Schema attribute of the resource, which holds
+// either the schema itself or the ID of a resource containing it. Violations
+// are reported as ErrSchemaViolation. Resources without a Schema attribute
+// are not validated.
+//
+// Only a subset of JSON Schema is supported: type, enum, properties,
+// required, additionalProperties, items, minimum, maximum, minLength,
+// maxLength, minItems and maxItems.
+func LoadJSONValidated(a *Archive, id string, v interface{}) error {
+	res, err := a.Load(id)
+	if err != nil {
+		return err
+	}
+	if ref, ok := res.Attributes[AttributeSchema]; ok {
+		schema, err := resolveSchema(a, ref)
+		if err != nil {
+			return err
+		}
+		var doc interface{}
+		if err := json.Unmarshal(res.Data, &doc); err != nil {
+			return err
+		}
+		if err := validateSchema(schema, doc, "$"); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(res.Data, v)
+}
+
+func resolveSchema(a *Archive, ref string) (map[string]interface{}, error) {
+	data := []byte(ref)
+	if !strings.HasPrefix(strings.TrimSpace(ref), "{") {
+		res, err := a.Load(ref)
+		if err != nil {
+			return nil, fmt.Errorf("archive: schema %s: %w", ref, err)
+		}
+		data = res.Data
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("archive: invalid schema: %w", err)
+	}
+	return schema, nil
+}
+
+func validateSchema(schema map[string]interface{}, v interface{}, path string) error {
+	violation := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s %s", ErrSchemaViolation, path, fmt.Sprintf(format, args...))
+	}
+	if t, ok := schema["type"]; ok && !hasSchemaType(t, v) {
+		return violation("is not of type %v", t)
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			found = found || reflect.DeepEqual(e, v)
+		}
+		if !found {
+			return violation("is not one of %v", enum)
+		}
+	}
+	switch v := v.(type) {
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			return violation("is less than %v", min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			return violation("is greater than %v", max)
+		}
+	case string:
+		n := float64(utf8.RuneCountInString(v))
+		if min, ok := schema["minLength"].(float64); ok && n < min {
+			return violation("is shorter than %v", min)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && n > max {
+			return violation("is longer than %v", max)
+		}
+	case []interface{}:
+		if min, ok := schema["minItems"].(float64); ok && float64(len(v)) < min {
+			return violation("has fewer than %v items", min)
+		}
+		if max, ok := schema["maxItems"].(float64); ok && float64(len(v)) > max {
+			return violation("has more than %v items", max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if k, _ := r.(string); k != "" {
+					if _, ok := v[k]; !ok {
+						return violation("lacks required property %q", k)
+					}
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub, ok := properties[k].(map[string]interface{})
+			if !ok {
+				switch additional := schema["additionalProperties"].(type) {
+				case bool:
+					if !additional {
+						return violation("has unexpected property %q", k)
+					}
+					continue
+				case map[string]interface{}:
+					sub = additional
+				default:
+					continue
+				}
+			}
+			if err := validateSchema(sub, v[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasSchemaType(t interface{}, v interface{}) bool {
+	if ts, ok := t.([]interface{}); ok {
+		for _, t := range ts {
+			if hasSchemaType(t, v) {
+				return true
+			}
+		}
+		return false
+	}
+	switch t {
+	case "null":
+		return v == nil
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "array":
+		_, ok := v.([]interface{})
+		return ok
+	case "object":
+		_, ok := v.(map[string]interface{})
+		return ok
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package archive
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLoadJSONValidated(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	schema := `{"type":"object","required":["name"],"properties":{"name":{"type":"string","minLength":1},"tags":{"type":"array","items":{"type":"string"}}},"additionalProperties":false}`
+	a.Store(MakeResource("/schemas/item", Attributes{AttributeType: "application/schema+json"}, []byte(schema)))
+
+	tests := []struct {
+		name   string
+		schema string
+		data   string
+		valid  bool
+	}{
+		{"inline valid", schema, `{"name":"a","tags":["x"]}`, true},
+		{"inline missing required", schema, `{"tags":["x"]}`, false},
+		{"by id valid", "/schemas/item", `{"name":"b"}`, true},
+		{"by id wrong item type", "/schemas/item", `{"name":"b","tags":[1]}`, false},
+		{"by id unexpected property", "/schemas/item", `{"name":"b","size":2}`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			as := Attributes{AttributeType: TypeApplicationJSON, AttributeSchema: test.schema}
+			if err := a.Store(MakeResource("/doc", as, []byte(test.data))); err != nil {
+				t.Fatal(err)
+			}
+			var v struct {
+				Name string   `json:"name"`
+				Tags []string `json:"tags"`
+			}
+			err := LoadJSONValidated(a, "/doc", &v)
+			if test.valid && err != nil {
+				t.Fatalf("expected document to be valid but got %v", err)
+			}
+			if !test.valid && !errors.Is(err, ErrSchemaViolation) {
+				t.Fatalf("expected %v but got %v", ErrSchemaViolation, err)
+			}
+		})
+	}
+
+	a.Store(MakeResource("/plain", Attributes{AttributeType: TypeApplicationJSON}, []byte(`{"anything":true}`)))
+	var v map[string]interface{}
+	if err := LoadJSONValidated(a, "/plain", &v); err != nil || v["anything"] != true {
+		t.Fatalf("expected unvalidated load but got %v, %v", v, err)
+	}
+}
@@ -0,0 +1,53 @@
+package archive
+
+import (
+	"mime"
+	"net/http"
+)
+
+// A TypeSniffer determines the content type of data, returning "" or
+// "application/octet-stream" if it cannot tell.
+type TypeSniffer interface {
+	SniffType(data []byte) string
+}
+
+type TypeSnifferFunc func(data []byte) string
+
+func (f TypeSnifferFunc) SniffType(data []byte) string {
+	return f(data)
+}
+
+// sniffLen is the amount of data handed to a TypeSniffer.
+const sniffLen = 512
+
+// DetectType determines the content type of data from its first 512 bytes
+// using http.DetectContentType. It returns "" if the type is unknown.
+func DetectType(data []byte) string {
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+	if typ := http.DetectContentType(data); typ != "application/octet-stream" {
+		return typ
+	}
+	return ""
+}
+
+// detectType determines the content type from the file extension ext,
+// consulting the sniffer if the extension is unknown. It returns "" if the
+// type remains unknown, or application/octet-stream with
+// WithOctetStreamDefault.
+func (a *Archive) detectType(ext string, data []byte) string {
+	if typ := mime.TypeByExtension(ext); typ != "" {
+		return typ
+	}
+	if len(data) > sniffLen {
+		data = data[:sniffLen]
+	}
+	if typ := a.sniffer.SniffType(data); typ != "" && typ != "application/octet-stream" {
+		return typ
+	}
+	if a.octetStreamDefault {
+		return "application/octet-stream"
+	}
+	return ""
+}
@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestTypeSniffer(t *testing.T) {
+	var sniffed []byte
+	sniffer := TypeSnifferFunc(func(data []byte) string {
+		sniffed = data
+		return "application/x-fake"
+	})
+	a, err := Open(":memory:", WithTypeSniffer(sniffer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	dir := t.TempDir()
+	blob := filepath.Join(dir, "blob")
+	ioutil.WriteFile(blob, make([]byte, 1000), 0644)
+	if err := a.ImportFile("/blob", blob); err != nil {
+		t.Fatalf("expected import to succeed: %s", err)
+	}
+	if len(sniffed) != sniffLen {
+		t.Fatalf("expected sniffer to be consulted with %d bytes but got %d", sniffLen, len(sniffed))
+	}
+	as, _ := a.Attributes("/blob")
+	if got := as[AttributeType]; got != "application/x-fake" {
+		t.Fatalf("expected sniffed type but got %q", got)
+	}
+
+	sniffed = nil
+	page := filepath.Join(dir, "page.html")
+	ioutil.WriteFile(page, []byte("<p>hi</p>"), 0644)
+	a.ImportFile("/page", page)
+	if sniffed != nil {
+		t.Fatalf("expected sniffer not to be consulted for a known extension")
+	}
+}
+
+func TestDefaultTypeSniffer(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	dir := t.TempDir()
+	png := filepath.Join(dir, "image")
+	ioutil.WriteFile(png, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), 0644)
+	a.ImportFile("/image", png)
+	if as, _ := a.Attributes("/image"); as[AttributeType] != TypeImagePNG {
+		t.Fatalf("expected %q but got %q", TypeImagePNG, as[AttributeType])
+	}
+
+	unknown := filepath.Join(dir, "unknown")
+	ioutil.WriteFile(unknown, []byte{0, 1, 2, 3}, 0644)
+	a.ImportFile("/unknown", unknown)
+	if as, _ := a.Attributes("/unknown"); as.Has(AttributeType) {
+		t.Fatalf("expected no type for unknown data but got %q", as[AttributeType])
+	}
+}
+
+func TestDetectType(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), want: TypeImagePNG},
+		{data: []byte("<!DOCTYPE html><p>hi</p>"), want: "text/html; charset=utf-8"},
+		{data: []byte{0, 1, 2, 3}, want: ""},
+	}
+	for _, test := range tests {
+		if got := DetectType(test.data); got != test.want {
+			t.Fatalf("expected %q but got %q", test.want, got)
+		}
+	}
+}
+
+func TestOctetStreamDefault(t *testing.T) {
+	a, err := Open(":memory:", WithOctetStreamDefault())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	unknown := filepath.Join(t.TempDir(), "unknown")
+	ioutil.WriteFile(unknown, []byte{0, 1, 2, 3}, 0644)
+	a.ImportFile("/unknown", unknown)
+	if as, _ := a.Attributes("/unknown"); as[AttributeType] != "application/octet-stream" {
+		t.Fatalf("expected %q but got %q", "application/octet-stream", as[AttributeType])
+	}
+}
@@ -0,0 +1,183 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// streamChunk is the number of bytes LoadStream reads per query.
+const streamChunk = 1 << 20
+
+// StoreStream stores the data read from r like StoreReader, computing its
+// length while reading, so r need not report its size up front.
+//
+// For file-backed archives with an inline threshold, see
+// WithInlineThreshold, the data is written to a file as it is read and only
+// read back if it turns out to be kept inline. This is not possible if it is
+// compressed or encrypted, versioned or inspected for image metadata, and
+// then the data is buffered once before it is handed to the driver, since
+// the sqlite3 driver does not expose SQLite's incremental blob I/O.
+func (a *Archive) StoreStream(id string, as Attributes, r io.Reader) error {
+	return a.StoreReader(id, as, r)
+}
+
+// spools reports whether StoreTee writes the data to a file as it is read,
+// which requires it to be stored exactly as read.
+func (a *Archive) spools() bool {
+	return a.blobs != "" && a.inlineThreshold > 0 && !a.compress && a.aead == nil && !a.versioning && !a.imageMetadata
+}
+
+// storeSpooled stores the data read from r by way of a temporary file in the
+// blob directory, which becomes the data file of the resource unless the
+// data is small enough to be kept inline.
+func (a *Archive) storeSpooled(id string, as Attributes, r io.Reader, tee io.Writer) error {
+	if err := os.MkdirAll(a.blobs, 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(a.blobs, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h, tee), r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	sum := checksumPrefix + hex.EncodeToString(h.Sum(nil))
+	if n <= a.inlineThreshold {
+		data, err := ioutil.ReadFile(f.Name())
+		if err != nil {
+			return err
+		}
+		return a.store(id, as, data, sum)
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		as, err := a.putAttributes(ctx, tx, id, as, nil, n, sum)
+		if err != nil {
+			return err
+		}
+		delete(as, AttributeEncoding)
+		// the file is moved into place while the archive is locked, so that
+		// it is not collected as unreferenced before the row refers to it
+		_, name := splitChecksum(sum)
+		if err := os.Rename(f.Name(), filepath.Join(a.blobs, name)); err != nil {
+			return err
+		}
+		if err := insert(ctx, tx, id, as, nil, n, sql.NullString{String: name, Valid: true}); err != nil {
+			return err
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
+
+// LoadStream returns a reader for the data of a resource together with its
+// attributes. For file-backed archives the data of resources that are stored
+// without an Encoding is never held in memory as a whole: it is read from its
+// file if it is kept outside the database, see WithInlineThreshold, and in
+// chunks as the reader is consumed otherwise. Should the resource change
+// while it is read in chunks, the reader fails with ErrChecksumMismatch. The
+// reader must be closed by the caller.
+func (a *Archive) LoadStream(id string) (io.ReadCloser, Attributes, error) {
+	if _, ok := a.derivation(id); ok || isMemory(a.dsn) || a.aead != nil {
+		return a.Reader(id)
+	}
+	as, err := a.Attributes(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if enc := as[AttributeEncoding]; enc != "" && enc != EncodingIdentity {
+		return a.Reader(id)
+	}
+	ctx, cancel := a.context()
+	defer cancel()
+	var external sql.NullString
+	if err := a.reader().QueryRowContext(ctx, `SELECT EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&external); err != nil {
+		return nil, nil, a.translate(ctx, err)
+	}
+	if a.access != nil {
+		if err := a.countAccess(id); err != nil {
+			return nil, nil, err
+		}
+	}
+	if coldID, ok := tiered(external); ok {
+		if cold := a.coldTier(); cold != nil {
+			r, _, err := cold.LoadStream(coldID)
+			return r, as, err
+		}
+		return a.Reader(id)
+	}
+	if external.Valid {
+		f, err := os.Open(filepath.Join(a.blobs, external.String))
+		if err != nil {
+			return nil, nil, err
+		}
+		return f, as, nil
+	}
+	return &chunkReader{a: a, id: id, sum: as[AttributeChecksum], h: sha256.New()}, as, nil
+}
+
+// chunkReader reads the data of a resource with one query per chunk.
+type chunkReader struct {
+	a      *Archive
+	id     string
+	sum    string
+	h      hash.Hash
+	offset int64
+	buf    []byte
+	eof    bool
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.eof {
+			return 0, io.EOF
+		}
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+		if len(r.buf) == 0 {
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *chunkReader) fill() error {
+	ctx, cancel := r.a.context()
+	defer cancel()
+	var chunk []byte
+	err := r.a.reader().QueryRowContext(ctx, `SELECT SUBSTR(DATA, ?, ?) FROM RESOURCES WHERE ID = ?;`, r.offset+1, streamChunk, r.id).Scan(&chunk)
+	if err == sql.ErrNoRows {
+		return ErrChecksumMismatch
+	}
+	if err != nil {
+		return r.a.translate(ctx, err)
+	}
+	r.h.Write(chunk)
+	r.offset += int64(len(chunk))
+	r.buf = chunk
+	if len(chunk) < streamChunk {
+		r.eof = true
+		if r.sum != "" && r.sum != checksumPrefix+hex.EncodeToString(r.h.Sum(nil)) {
+			return ErrChecksumMismatch
+		}
+	}
+	return nil
+}
+
+func (r *chunkReader) Close() error {
+	return nil
+}
@@ -0,0 +1,145 @@
+package archive
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	a, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), streamChunk/8+3)
+	if err := a.StoreStream("/large", Attributes{AttributeType: "application/octet-stream"}, bytes.NewReader(data)); err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+	r, as, err := a.LoadStream("/large")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	if _, ok := r.(*chunkReader); !ok {
+		t.Fatalf("expected a chunked reader but got %T", r)
+	}
+	got, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatalf("expected read to succeed: %s", err)
+	}
+	if !bytes.Equal(data, got) {
+		t.Fatalf("expected %d bytes but got %d", len(data), len(got))
+	}
+	if want := strconv.Itoa(len(data)); as[AttributeLength] != want {
+		t.Fatalf("expected length %s but got %s", want, as[AttributeLength])
+	}
+
+	r, _, _ = a.LoadStream("/large")
+	defer r.Close()
+	buf := make([]byte, 10)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	a.Store(TextPlain("/large", strings.Repeat("changed", streamChunk/4)))
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected %v but got %v", ErrChecksumMismatch, err)
+	}
+}
+
+func TestExportFileStreams(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/a", "alpha"))
+	file := filepath.Join(dir, "a.txt")
+	if err := a.ExportFile("/a", file); err != nil {
+		t.Fatalf("expected export to succeed: %s", err)
+	}
+	if got, _ := ioutil.ReadFile(file); string(got) != "alpha" {
+		t.Fatalf("expected %q but got %q", "alpha", got)
+	}
+	if _, _, err := a.LoadStream("/missing"); err == nil {
+		t.Fatalf("expected loading a missing resource to fail")
+	}
+}
+
+// spoolReader produces size bytes and records the largest temporary file it
+// saw in dir while being read.
+type spoolReader struct {
+	dir     string
+	size    int
+	spooled int64
+}
+
+func (r *spoolReader) Read(p []byte) (int, error) {
+	if r.size == 0 {
+		return 0, io.EOF
+	}
+	if files, _ := filepath.Glob(filepath.Join(r.dir, ".tmp-*")); len(files) == 1 {
+		if info, err := os.Stat(files[0]); err == nil && info.Size() > r.spooled {
+			r.spooled = info.Size()
+		}
+	}
+	if len(p) > r.size {
+		p = p[:r.size]
+	}
+	for i := range p {
+		p[i] = byte(r.size - i)
+	}
+	r.size -= len(p)
+	return len(p), nil
+}
+
+func TestStoreStreamSpools(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	a, err := Open(file, WithInlineThreshold(1024))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	r := &spoolReader{dir: file + ".blobs", size: 4 << 20}
+	if err := a.StoreStream("/large", Attributes{AttributeType: "application/octet-stream"}, r); err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+	if r.spooled < 1<<20 {
+		t.Fatalf("expected the data to be written to a file while it is read but only saw %d bytes", r.spooled)
+	}
+	res, err := a.Load("/large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data) != 4<<20 || res.Attributes[AttributeChecksum] != Checksum(res.Data) || res.Attributes[AttributeLength] != strconv.Itoa(4<<20) {
+		t.Fatalf("expected the streamed data with its length and checksum but got %s", res.Attributes)
+	}
+	var external sql.NullString
+	a.db.QueryRow(`SELECT EXTERNAL FROM RESOURCES WHERE ID = ?;`, "/large").Scan(&external)
+	if !external.Valid {
+		t.Fatalf("expected the data to be kept in a file")
+	}
+	if files, _ := filepath.Glob(filepath.Join(file+".blobs", ".tmp-*")); len(files) != 0 {
+		t.Fatalf("expected no temporary files to be left but got %v", files)
+	}
+
+	small := filepath.Join(t.TempDir(), "small.txt")
+	ioutil.WriteFile(small, []byte("small"), 0644)
+	if err := a.ImportFile("/small", small); err != nil {
+		t.Fatalf("expected import to succeed: %s", err)
+	}
+	if res, _ := a.Load("/small"); string(res.Data) != "small" || res.Attributes.MediaType() != "text/plain" {
+		t.Fatalf("expected the small file to be imported inline but got %q (%s)", res.Data, res.Attributes)
+	}
+}
@@ -0,0 +1,168 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// tierPrefix marks the EXTERNAL column of a resource whose data was moved to
+// the cold archive by Tier. The rest of the value is the ID of the data in
+// the cold archive, which survives renaming the resource.
+const tierPrefix = "cold:"
+
+func tiered(external sql.NullString) (string, bool) {
+	if !external.Valid || !strings.HasPrefix(external.String, tierPrefix) {
+		return "", false
+	}
+	return external.String[len(tierPrefix):], true
+}
+
+// Tier moves the data of a resource to cold and keeps only a stub with its
+// attributes in the archive. Loading, streaming, verifying and exporting the
+// resource transparently fetch the data from cold, and Untier moves it back.
+// The data is written to cold as it is stored, so cold keeps an exact copy of
+// the resource. Deleting the stub leaves the copy in cold. Neither changes the
+// resource, so a mirror, see WithMirror, keeps its data.
+//
+// The archive remembers cold until it is closed; use WithColdTier to set it
+// when reopening an archive with tiered resources.
+func (a *Archive) Tier(id string, cold *Archive) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	if cold == nil || cold == a {
+		return fmt.Errorf("archive: invalid cold archive for %s", id)
+	}
+	a.setCold(cold)
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		var attributes string
+		var data []byte
+		var external sql.NullString
+		err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES, DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes, &data, &external)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := tiered(external); ok {
+			return nil
+		}
+		if data, err = a.fetch(data, external); err != nil {
+			return err
+		}
+		if err := cold.storeStored(id, attributes, data); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE RESOURCES SET DATA = NULL, SIZE = 0, EXTERNAL = ? WHERE ID = ?;`, tierPrefix+id, id)
+		return err
+	})
+}
+
+// Untier moves the data of a resource tiered by Tier back from the cold
+// archive. It does nothing if the resource is not tiered.
+func (a *Archive) Untier(id string) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	var coldID string
+	err := a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		var external sql.NullString
+		err := tx.QueryRowContext(ctx, `SELECT EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&external)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if coldID, ok = tiered(external); !ok {
+			return nil
+		}
+		data, err := a.fetch(nil, external)
+		if err != nil {
+			return err
+		}
+		if err := checkQuota(ctx, tx, id, int64(len(data))); err != nil {
+			return err
+		}
+		sealed, err := a.seal(data)
+		if err != nil {
+			return err
+		}
+		inline, external, err := a.externalize(sealed)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE RESOURCES SET DATA = ?, SIZE = ?, EXTERNAL = ? WHERE ID = ?;`, inline, len(data), external, id)
+		return err
+	})
+	if err != nil || coldID == "" {
+		return err
+	}
+	return a.coldTier().ForceDelete(coldID)
+}
+
+// storeStored stores data exactly as given, without encoding it or touching
+// its attributes.
+func (a *Archive) storeStored(id string, attributes string, stored []byte) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	as, err := ParseAttributes(attributes)
+	if err != nil {
+		return err
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		sealed, err := a.seal(stored)
+		if err != nil {
+			return err
+		}
+		inline, external, err := a.externalize(sealed)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO RESOURCES (ID, ATTRIBUTES, DATA, SIZE, MODIFIED, EXTERNAL) VALUES (?, ?, ?, ?, ?, ?);`, id, attributes, inline, len(stored), as[AttributeLastModified], external); err != nil {
+			return err
+		}
+		if err := recordChange(ctx, tx, id, changeStored); err != nil {
+			return err
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
+
+// fetchCold returns the stored data of the resource coldID of the cold
+// archive.
+func (a *Archive) fetchCold(coldID string) ([]byte, error) {
+	cold := a.coldTier()
+	if cold == nil {
+		return nil, fmt.Errorf("archive: no cold archive for tiered resource %s", coldID)
+	}
+	ctx, cancel := cold.context()
+	defer cancel()
+	var data []byte
+	var external sql.NullString
+	err := cold.db.QueryRowContext(ctx, `SELECT DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, coldID).Scan(&data, &external)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: tiered resource %s is missing from the cold archive", ErrCorrupt, coldID)
+	}
+	if err != nil {
+		return nil, cold.translate(ctx, err)
+	}
+	return cold.fetch(data, external)
+}
+
+func (a *Archive) setCold(cold *Archive) {
+	a.coldMu.Lock()
+	defer a.coldMu.Unlock()
+	a.cold = cold
+}
+
+func (a *Archive) coldTier() *Archive {
+	a.coldMu.Lock()
+	defer a.coldMu.Unlock()
+	return a.cold
+}
@@ -0,0 +1,85 @@
+package archive
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTier(t *testing.T) {
+	dir := t.TempDir()
+	hotFile, coldFile := filepath.Join(dir, "hot.db"), filepath.Join(dir, "cold.db")
+	hot, err := Open(hotFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cold, err := Open(coldFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cold.Close()
+	hot.Store(TextPlain("/doc", "rarely read"))
+	before, _ := hot.Attributes("/doc")
+
+	if err := hot.Tier("/doc", cold); err != nil {
+		t.Fatal(err)
+	}
+	if _, n, _, err := hot.RawRow("/doc"); err != nil || n != 0 {
+		t.Fatalf("expected no data in the hot archive but got %d bytes (%v)", n, err)
+	}
+	if res, err := cold.Load("/doc"); err != nil || string(res.Data) != "rarely read" {
+		t.Fatalf("expected the data in the cold archive but got %q (%v)", res.Data, err)
+	}
+	res, err := hot.Load("/doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Data) != "rarely read" {
+		t.Fatalf("expected %q but got %q", "rarely read", res.Data)
+	}
+	if !reflect.DeepEqual(before, res.Attributes) {
+		t.Fatalf("expected %v but got %v", before, res.Attributes)
+	}
+	if err := hot.Verify("/doc"); err != nil {
+		t.Fatal(err)
+	}
+	r, _, err := hot.LoadStream("/doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(r)
+	r.Close()
+	if string(data) != "rarely read" {
+		t.Fatalf("expected %q but got %q", "rarely read", data)
+	}
+
+	hot.Close()
+	if hot, err = Open(hotFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hot.Load("/doc"); err == nil {
+		t.Fatalf("expected an error without a cold archive")
+	}
+	hot.Close()
+	if hot, err = Open(hotFile, WithColdTier(cold)); err != nil {
+		t.Fatal(err)
+	}
+	defer hot.Close()
+	if res, err := hot.Load("/doc"); err != nil || string(res.Data) != "rarely read" {
+		t.Fatalf("expected %q after reopening but got %q (%v)", "rarely read", res.Data, err)
+	}
+
+	if err := hot.Untier("/doc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, n, _, _ := hot.RawRow("/doc"); n != int64(len("rarely read")) {
+		t.Fatalf("expected the data back in the hot archive but got %d bytes", n)
+	}
+	if ok, _ := cold.Exists("/doc"); ok {
+		t.Fatalf("expected the cold copy to be removed")
+	}
+	if res, err := hot.Load("/doc"); err != nil || string(res.Data) != "rarely read" {
+		t.Fatalf("expected %q but got %q (%v)", "rarely read", res.Data, err)
+	}
+}
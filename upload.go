@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// WriteAt writes data at offset into the data of the resource id, creating
+// the resource if necessary. Gaps are filled with zeros. Since the resource is
+// incomplete until all ranges have arrived, WriteAt drops its checksum and
+// ETag and does not bump the revision; call Finalize once the upload is
+// complete.
+func (a *Archive) WriteAt(id string, offset int64, data []byte) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	if offset < 0 {
+		return fmt.Errorf("archive: negative offset %d", offset)
+	}
+	// the data it replaces, if kept outside the DATA column, is removed once
+	// the write is committed
+	var blob, coldID string
+	err := a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		var attributes string
+		var cur []byte
+		var external sql.NullString
+		err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES, DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes, &cur, &external)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if cur, err = a.fetch(cur, external); err != nil {
+			return err
+		}
+		as, err := ParseAttributes(attributes)
+		if err != nil {
+			return err
+		}
+		if cur, err = decode(as, cur); err != nil {
+			return err
+		}
+		delete(as, AttributeEncoding)
+		end := offset + int64(len(data))
+		if end > int64(len(cur)) {
+			grown := make([]byte, end)
+			copy(grown, cur)
+			cur = grown
+		}
+		copy(cur[offset:], data)
+		if err := checkQuota(ctx, tx, id, int64(len(cur))); err != nil {
+			return err
+		}
+		delete(as, AttributeChecksum)
+		delete(as, AttributeETag)
+		as[AttributeLength] = fmt.Sprintf("%d", len(cur))
+		sealed, err := a.seal(cur)
+		if err != nil {
+			return err
+		}
+		inline, written, err := a.externalize(sealed)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO RESOURCES (ID, ATTRIBUTES, DATA, SIZE, MODIFIED, EXTERNAL) VALUES (?, ?, ?, ?, ?, ?);`, id, as.String(), inline, len(cur), as[AttributeLastModified], written); err != nil {
+			return err
+		}
+		if cold, ok := tiered(external); ok {
+			coldID = cold
+		} else if external.Valid && external != written {
+			blob = external.String
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if coldID != "" {
+		return a.coldTier().ForceDelete(coldID)
+	}
+	if blob != "" {
+		return a.removeBlob(blob)
+	}
+	return nil
+}
+
+// Finalize completes a resource written with WriteAt by setting its length,
+// checksum and modification time, and bumps the revision.
+func (a *Archive) Finalize(id string) error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	return a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		var attributes string
+		var data []byte
+		var external sql.NullString
+		if err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES, DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes, &data, &external); err != nil {
+			return err
+		}
+		data, err := a.fetch(data, external)
+		if err != nil {
+			return err
+		}
+		as, err := ParseAttributes(attributes)
+		if err != nil {
+			return err
+		}
+		if data, err = decode(as, data); err != nil {
+			return err
+		}
+		if err := a.put(ctx, tx, id, as, data, Checksum(data)); err != nil {
+			return err
+		}
+		return bumpRevision(ctx, tx)
+	})
+}
@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteAtFinalize(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.WriteAt("/upload", 6, []byte("world")); err != nil {
+		t.Fatalf("expected write to succeed: %s", err)
+	}
+	if err := a.WriteAt("/upload", 0, []byte("hello")); err != nil {
+		t.Fatalf("expected write to succeed: %s", err)
+	}
+	if rev := a.Revision(); rev != 0 {
+		t.Fatalf("expected revision to be %d but was %d", 0, rev)
+	}
+	if err := a.Finalize("/upload"); err != nil {
+		t.Fatalf("expected finalize to succeed: %s", err)
+	}
+	if rev := a.Revision(); rev != 1 {
+		t.Fatalf("expected revision to be %d but was %d", 1, rev)
+	}
+
+	res, err := a.Load("/upload")
+	if err != nil {
+		t.Fatalf("expected load to succeed: %s", err)
+	}
+	want := []byte("hello\x00world")
+	if !bytes.Equal(want, res.Data) {
+		t.Fatalf("expected %q but got %q", want, res.Data)
+	}
+	if got := res.Attributes[AttributeChecksum]; got != Checksum(want) {
+		t.Fatalf("expected checksum %q but got %q", Checksum(want), got)
+	}
+	if err := a.Verify("/upload"); err != nil {
+		t.Fatalf("expected finalized resource to verify: %s", err)
+	}
+}
+
+func TestWriteAtExternal(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "archive.db")
+	a, err := Open(file, WithInlineThreshold(16))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	cold, err := Open(filepath.Join(dir, "cold.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cold.Close()
+
+	old := strings.Repeat("a", 32)
+	a.Store(TextPlain("/upload", old))
+	if err := a.WriteAt("/upload", 32, []byte(strings.Repeat("b", 32))); err != nil {
+		t.Fatalf("expected write to succeed: %s", err)
+	}
+	as, _ := a.Attributes("/upload")
+	if as.Has(AttributeETag) || as.Has(AttributeChecksum) {
+		t.Fatalf("expected the ETag and checksum to be dropped but got %s", as)
+	}
+	var external sql.NullString
+	a.db.QueryRow(`SELECT EXTERNAL FROM RESOURCES WHERE ID = ?;`, "/upload").Scan(&external)
+	if !external.Valid {
+		t.Fatalf("expected the written data to be kept in a file")
+	}
+	_, name := splitChecksum(Checksum([]byte(old)))
+	if _, err := os.Stat(filepath.Join(file+".blobs", name)); !os.IsNotExist(err) {
+		t.Fatalf("expected the replaced data file to be removed but got %v", err)
+	}
+	if err := a.Finalize("/upload"); err != nil {
+		t.Fatalf("expected finalize to succeed: %s", err)
+	}
+	want := old + strings.Repeat("b", 32)
+	res, err := a.Load("/upload")
+	if err != nil || string(res.Data) != want {
+		t.Fatalf("expected %q but got %q (%v)", want, res.Data, err)
+	}
+	if got := res.Attributes[AttributeETag]; got != etag(Checksum([]byte(want))) {
+		t.Fatalf("expected the ETag of the written data but got %q", got)
+	}
+
+	if err := a.Tier("/upload", cold); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.WriteAt("/upload", 0, []byte("c")); err != nil {
+		t.Fatalf("expected write to succeed: %s", err)
+	}
+	if ok, _ := cold.Exists("/upload"); ok {
+		t.Fatalf("expected the replaced data to be removed from the cold archive")
+	}
+	if res, _ := a.Load("/upload"); string(res.Data) != "c"+want[1:] {
+		t.Fatalf("expected %q but got %q", "c"+want[1:], res.Data)
+	}
+}
@@ -0,0 +1,36 @@
+package archive
+
+import "fmt"
+
+// Vacuum rebuilds the database file to reclaim the space left by deleted and
+// replaced resources, truncates the write-ahead log and removes unreferenced
+// external data files. It waits for queued and in-flight writes and blocks
+// new ones until it is done, and it fails with ErrInMemory for in-memory
+// archives, which have no file to shrink.
+func (a *Archive) Vacuum() error {
+	if err := a.writable(); err != nil {
+		return err
+	}
+	if isMemory(a.dsn) {
+		return fmt.Errorf("%w: nothing to vacuum", ErrInMemory)
+	}
+	if a.queue != nil {
+		a.queue.wait()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ctx, cancel := a.context()
+	defer cancel()
+	if _, err := a.db.ExecContext(ctx, `VACUUM;`); err != nil {
+		return a.translate(ctx, err)
+	}
+	if _, err := a.db.ExecContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE);`); err != nil {
+		return a.translate(ctx, err)
+	}
+	if a.blobs != "" {
+		if err := a.collectBlobs(ctx, a.db); err != nil {
+			return a.translate(ctx, err)
+		}
+	}
+	return nil
+}
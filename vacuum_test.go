@@ -0,0 +1,48 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVacuum(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "archive.db")
+	a, err := Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	data := strings.Repeat("x", 64<<10)
+	for i := 0; i < 32; i++ {
+		a.Store(TextPlain(fmt.Sprintf("/%d", i), data))
+	}
+	a.Store(TextPlain("/keep", "keep"))
+	a.DeleteWithPrefix("/")
+	a.Store(TextPlain("/keep", "keep"))
+	before, _ := os.Stat(file)
+
+	if err := a.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(file)
+	if after.Size() >= before.Size() {
+		t.Fatalf("expected the file to shrink from %d bytes but it has %d", before.Size(), after.Size())
+	}
+	if res, err := a.Load("/keep"); err != nil || string(res.Data) != "keep" {
+		t.Fatalf("expected %q but got %q (%v)", "keep", res.Data, err)
+	}
+
+	m, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Vacuum(); !errors.Is(err, ErrInMemory) {
+		t.Fatalf("expected %v but got %v", ErrInMemory, err)
+	}
+}
@@ -0,0 +1,52 @@
+package archive
+
+import "strings"
+
+// StoreVariant stores r, regardless of its ID, as the variant of id with the
+// given key. Variants are alternative representations of a logical resource,
+// stored under its ID followed by a dot and the key, such as "/logo.jpeg" and
+// "/logo.webp" for "/logo". The Handler negotiates between them by type.
+func (a *Archive) StoreVariant(id, key string, r Resource) error {
+	if !isVariantKey(key) {
+		return ErrInvalidVariant
+	}
+	return a.store(id+"."+key, r.Attributes, r.Data, Checksum(r.Data))
+}
+
+func (a *Archive) LoadVariant(id, key string) (Resource, error) {
+	if !isVariantKey(key) {
+		return Resource{}, ErrInvalidVariant
+	}
+	return a.Load(id + "." + key)
+}
+
+// Variants lists the keys of the variants of id in order.
+func (a *Archive) Variants(id string) ([]string, error) {
+	ds, err := a.variants(id)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, d := range ds {
+		keys = append(keys, d.ID[len(id)+1:])
+	}
+	return keys, nil
+}
+
+func (a *Archive) variants(id string) ([]Descriptor, error) {
+	ds, err := a.ListWithPrefix(id + ".")
+	if err != nil {
+		return nil, err
+	}
+	var res []Descriptor
+	for _, d := range ds {
+		if strings.HasPrefix(d.ID, id+".") && isVariantKey(d.ID[len(id)+1:]) {
+			res = append(res, d)
+		}
+	}
+	return res, nil
+}
+
+func isVariantKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, "./")
+}
@@ -0,0 +1,42 @@
+package archive
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVariants(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	if err := a.StoreVariant("/logo", "jpeg", JPEG("", []byte("jpeg"))); err != nil {
+		t.Fatalf("expected store to succeed: %s", err)
+	}
+	a.StoreVariant("/logo", "webp", MakeResource("", Attributes{AttributeType: "image/webp"}, []byte("webp")))
+	a.Store(TextPlain("/logo.webp.txt", "not a variant"))
+
+	for _, key := range []string{"jpeg", "webp"} {
+		r, err := a.LoadVariant("/logo", key)
+		if err != nil {
+			t.Fatalf("expected load of %q to succeed: %s", key, err)
+		}
+		if string(r.Data) != key {
+			t.Fatalf("expected %q but got %q", key, r.Data)
+		}
+	}
+
+	keys, err := a.Variants("/logo")
+	if err != nil {
+		t.Fatalf("expected variants to be listed: %s", err)
+	}
+	if want := []string{"jpeg", "webp"}; !reflect.DeepEqual(want, keys) {
+		t.Fatalf("expected %v but got %v", want, keys)
+	}
+
+	if err := a.StoreVariant("/logo", "a/b", TextPlain("", "")); err != ErrInvalidVariant {
+		t.Fatalf("expected %v but got %v", ErrInvalidVariant, err)
+	}
+}
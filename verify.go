@@ -0,0 +1,170 @@
+package archive
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Verify checks the data of a resource against its Length and Checksum
+// attributes and returns ErrChecksumMismatch if they disagree.
+func (a *Archive) Verify(id string) error {
+	ctx, cancel := a.context()
+	defer cancel()
+	var attributes string
+	var data []byte
+	var external sql.NullString
+	err := a.reader().QueryRowContext(ctx, `SELECT ATTRIBUTES, DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes, &data, &external)
+	if err != nil {
+		return a.translate(ctx, err)
+	}
+	if data, err = a.fetch(data, external); err != nil {
+		return err
+	}
+	as, err := ParseAttributes(attributes)
+	if err != nil {
+		return err
+	}
+	return verify(id, as, data)
+}
+
+func verify(id string, as Attributes, stored []byte) error {
+	data, err := decode(as, stored)
+	if err != nil {
+		return fmt.Errorf("%w: %s cannot be decoded: %v", ErrChecksumMismatch, id, err)
+	}
+	if l, ok := as[AttributeLength]; ok {
+		if n, err := strconv.Atoi(l); err != nil || n != len(data) {
+			return fmt.Errorf("%w: %s has length %d but %s is %q", ErrChecksumMismatch, id, len(data), AttributeLength, l)
+		}
+	}
+	if sum, ok := as[AttributeChecksum]; ok {
+		if got := Checksum(data); got != sum {
+			return fmt.Errorf("%w: %s has %s but %s is %q", ErrChecksumMismatch, id, got, AttributeChecksum, sum)
+		}
+	}
+	return nil
+}
+
+// VerifyAll verifies every resource and returns the sorted IDs of those that
+// failed verification.
+func (a *Archive) VerifyAll() ([]string, error) {
+	return a.VerifyAllParallel(1)
+}
+
+// VerifyAllParallel is like VerifyAll but verifies up to workers resources
+// concurrently, each loading a single resource at a time.
+func (a *Archive) VerifyAllParallel(workers int) ([]string, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	ds, err := a.List()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make(chan string)
+	var mu sync.Mutex
+	var failed []string
+	var firstErr error
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ids {
+				err := a.Verify(id)
+				mu.Lock()
+				switch {
+				case errors.Is(err, ErrChecksumMismatch), errors.Is(err, ErrAuthenticationFailed):
+					failed = append(failed, id)
+				case err != nil && err != sql.ErrNoRows && firstErr == nil:
+					// resources deleted since listing are no failure
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, d := range ds {
+		ids <- d.ID
+	}
+	close(ids)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	sort.Strings(failed)
+	return failed, nil
+}
+
+// BackfillChecksums sets the Checksum attribute of every resource that lacks
+// a well-formed one, and the ETag of every resource that lacks one, leaving
+// data and modification times untouched. It returns the number of updated
+// resources.
+func (a *Archive) BackfillChecksums() (int, error) {
+	if err := a.writable(); err != nil {
+		return 0, err
+	}
+	n := 0
+	err := a.write(context.Background(), func(ctx context.Context, tx *sql.Tx) error {
+		ids, err := matching(ctx, tx, func(as Attributes) bool {
+			return !wellFormedChecksum(as[AttributeChecksum]) || as[AttributeETag] == ""
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			var attributes string
+			var data []byte
+			var external sql.NullString
+			if err := tx.QueryRowContext(ctx, `SELECT ATTRIBUTES, DATA, EXTERNAL FROM RESOURCES WHERE ID = ?;`, id).Scan(&attributes, &data, &external); err != nil {
+				return err
+			}
+			as, err := ParseAttributes(attributes)
+			if err != nil {
+				return err
+			}
+			if !wellFormedChecksum(as[AttributeChecksum]) {
+				data, err := a.fetch(data, external)
+				if err != nil {
+					return err
+				}
+				if data, err = decode(as, data); err != nil {
+					return fmt.Errorf("%s: %v", id, err)
+				}
+				as[AttributeChecksum] = Checksum(data)
+			}
+			if as[AttributeETag] == "" {
+				as[AttributeETag] = etag(as[AttributeChecksum])
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE RESOURCES SET ATTRIBUTES = ? WHERE ID = ?;`, as.String(), id); err != nil {
+				return err
+			}
+			if err := recordChange(ctx, tx, id, changeStored); err != nil {
+				return err
+			}
+			n++
+		}
+		if n > 0 {
+			return bumpRevision(ctx, tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func wellFormedChecksum(sum string) bool {
+	algo, digest := splitChecksum(sum)
+	b, err := hex.DecodeString(digest)
+	return algo+":" == checksumPrefix && err == nil && len(b) == 32
+}
@@ -0,0 +1,83 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyAllParallel(t *testing.T) {
+	a, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	for i := 0; i < 20; i++ {
+		a.Store(TextPlain(fmt.Sprintf("/%02d", i), fmt.Sprintf("resource %d", i)))
+	}
+	corrupted := []string{"/03", "/11", "/17"}
+	for _, id := range corrupted {
+		if _, err := a.db.Exec(`UPDATE RESOURCES SET DATA = ? WHERE ID = ?;`, []byte("garbage!!!"), id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := a.Verify("/03"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected %v but got %v", ErrChecksumMismatch, err)
+	}
+	if err := a.Verify("/04"); err != nil {
+		t.Fatalf("expected verify to succeed: %s", err)
+	}
+	for _, workers := range []int{1, 4, 32} {
+		got, err := a.VerifyAllParallel(workers)
+		if err != nil {
+			t.Fatalf("expected verify with %d workers to succeed: %s", workers, err)
+		}
+		if !reflect.DeepEqual(corrupted, got) {
+			t.Errorf("expected %v with %d workers but got %v", corrupted, workers, got)
+		}
+	}
+}
+
+func TestBackfillChecksums(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	a.Store(TextPlain("/current", "current"))
+	a.db.Exec(`INSERT INTO RESOURCES (ID, ATTRIBUTES, DATA, SIZE) VALUES (?, ?, ?, ?);`, "/legacy", "Type: text/plain\r\n", []byte("legacy"), 6)
+	a.db.Exec(`INSERT INTO RESOURCES (ID, ATTRIBUTES, DATA, SIZE) VALUES (?, ?, ?, ?);`, "/malformed", "Checksum: sha256:nothex\r\n", []byte("malformed"), 9)
+	a.db.Exec(`INSERT INTO RESOURCES (ID, ATTRIBUTES, DATA, SIZE) VALUES (?, ?, ?, ?);`, "/untagged", "Checksum: "+Checksum([]byte("untagged"))+"\r\n", []byte("untagged"), 8)
+	before, _ := a.Attributes("/current")
+
+	n, err := a.BackfillChecksums()
+	if err != nil {
+		t.Fatalf("expected backfill to succeed: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("expected %d updated resources but got %d", 3, n)
+	}
+	for _, id := range []string{"/current", "/legacy", "/malformed", "/untagged"} {
+		if err := a.Verify(id); err != nil {
+			t.Fatalf("expected %s to verify: %s", id, err)
+		}
+		as, _ := a.Attributes(id)
+		if !as.Has(AttributeChecksum) {
+			t.Fatalf("expected %s to have a checksum", id)
+		}
+		if want := etag(as[AttributeChecksum]); as[AttributeETag] != want {
+			t.Fatalf("expected %s to have ETag %s but got %q", id, want, as[AttributeETag])
+		}
+	}
+	if after, _ := a.Attributes("/current"); !reflect.DeepEqual(before, after) {
+		t.Fatalf("expected %v to be untouched but got %v", before, after)
+	}
+	if n, _ := a.BackfillChecksums(); n != 0 {
+		t.Fatalf("expected nothing left to backfill but got %d", n)
+	}
+}
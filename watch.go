@@ -0,0 +1,97 @@
+package archive
+
+// EventKind tells what happened to the resource of an Event.
+type EventKind int
+
+const (
+	EventStored EventKind = iota + 1
+	EventDeleted
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventStored:
+		return "Stored"
+	case EventDeleted:
+		return "Deleted"
+	}
+	return "Unknown"
+}
+
+// Event describes a change to a resource committed at Revision.
+type Event struct {
+	ID       string
+	Kind     EventKind
+	Revision int
+}
+
+// watchBuffer is the number of events buffered per subscriber.
+const watchBuffer = 64
+
+// Watch subscribes to the changes made to the resources of the archive,
+// which are sent once committed, in the order of their revisions. Writers
+// never wait for subscribers: each has a buffer of 64 events, and events that
+// do not fit into it are dropped, so a subscriber that must not miss a change
+// should compare the Revision of the events it receives with Revision. The
+// returned func unsubscribes and closes the channel. Closing the archive
+// closes the channels of all subscribers.
+func (a *Archive) Watch() (<-chan Event, func()) {
+	ch := make(chan Event, watchBuffer)
+	a.watchMu.Lock()
+	if a.watchers == nil {
+		a.watchers = map[chan Event]bool{}
+	}
+	a.watchers[ch] = true
+	a.watchMu.Unlock()
+	return ch, func() {
+		a.watchMu.Lock()
+		defer a.watchMu.Unlock()
+		if a.watchers[ch] {
+			delete(a.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// watched reports whether anybody is watching.
+func (a *Archive) watched() bool {
+	a.watchMu.Lock()
+	defer a.watchMu.Unlock()
+	return len(a.watchers) > 0
+}
+
+// events returns the events of the changes cs.
+func events(cs []Change) []Event {
+	es := make([]Event, len(cs))
+	for i, c := range cs {
+		es[i] = Event{ID: c.ID, Kind: c.Kind, Revision: c.Revision}
+	}
+	return es
+}
+
+// publish sends es to all subscribers without blocking.
+func (a *Archive) publish(es []Event) {
+	if len(es) == 0 {
+		return
+	}
+	a.watchMu.Lock()
+	defer a.watchMu.Unlock()
+	for ch := range a.watchers {
+		for _, e := range es {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// unwatchAll closes the channels of all subscribers.
+func (a *Archive) unwatchAll() {
+	a.watchMu.Lock()
+	defer a.watchMu.Unlock()
+	for ch := range a.watchers {
+		delete(a.watchers, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,162 @@
+package archive
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	events, cancel := a.Watch()
+	rev := a.Revision()
+	a.Store(TextPlain("/a", "a"))
+	a.StoreBatch([]Resource{TextPlain("/p/b", "b"), TextPlain("/p/c", "c")})
+	a.Delete("/a")
+	a.Delete("/missing")
+	a.DeleteWithPrefix("/p/")
+
+	want := []Event{
+		{ID: "/a", Kind: EventStored, Revision: rev + 1},
+		{ID: "/p/b", Kind: EventStored, Revision: rev + 2},
+		{ID: "/p/c", Kind: EventStored, Revision: rev + 2},
+		{ID: "/a", Kind: EventDeleted, Revision: rev + 3},
+		{ID: "/p/b", Kind: EventDeleted, Revision: rev + 4},
+		{ID: "/p/c", Kind: EventDeleted, Revision: rev + 4},
+	}
+	var got []Event
+	for range want {
+		got = append(got, <-events)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("expected %v but got %v", want, got)
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Fatalf("expected the channel to be closed")
+	}
+	cancel()
+	a.Store(TextPlain("/a", "a"))
+}
+
+func TestWatchDropsForSlowSubscribers(t *testing.T) {
+	a, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, _ := a.Watch()
+	for i := 0; i < watchBuffer+10; i++ {
+		if err := a.Store(TextPlain("/a", "a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(events); n != watchBuffer {
+		t.Fatalf("expected %d buffered events but got %d", watchBuffer, n)
+	}
+
+	a.Close()
+	n := 0
+	for range events {
+		n++
+	}
+	if n != watchBuffer {
+		t.Fatalf("expected %d events before the channel is closed but got %d", watchBuffer, n)
+	}
+}
+
+func TestWatchAllWrites(t *testing.T) {
+	a, err := Open(":memory:", WithVersioning())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	pack, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pack.Close()
+	pack.Store(TextPlain("/packed", "packed"))
+	buf := &bytes.Buffer{}
+	if err := pack.ExportPack(buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := OpenPack(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.Store(TextPlain("/a", "a"))
+	events, cancel := a.Watch()
+	defer cancel()
+	rev := a.Revision()
+	as, _ := a.Attributes("/a")
+	algo, digest := splitChecksum(Checksum([]byte("c")))
+	cas := "/" + algo + "/" + digest
+	steps := []struct {
+		name string
+		run  func() error
+		want []Event
+	}{
+		{"StoreIfMatch", func() error { return a.StoreIfMatch(TextPlain("/a", "b"), as[AttributeETag]) }, []Event{{"/a", EventStored, rev + 1}}},
+		{"ReplaceSubtree", func() error { return a.ReplaceSubtree("/t/", []Resource{TextPlain("/t/x", "x")}) }, []Event{{"/t/x", EventStored, rev + 2}}},
+		{"StoreContentAddressed", func() error {
+			_, err := a.StoreContentAddressed(Attributes{}, []byte("c"))
+			return err
+		}, []Event{{cas, EventStored, rev + 3}}},
+		{"Rename", func() error { return a.Rename("/t/x", "/t/y") }, []Event{{"/t/x", EventDeleted, rev + 4}, {"/t/y", EventStored, rev + 4}}},
+		{"Copy", func() error { return a.Copy("/t/y", "/t/z") }, []Event{{"/t/z", EventStored, rev + 5}}},
+		{"Promote", func() error { return a.Promote("/a", rev) }, []Event{{"/a", EventStored, rev + 6}}},
+		{"ImportPack", func() error {
+			_, err := a.ImportPack(p, ConflictOverwrite)
+			return err
+		}, []Event{{"/packed", EventStored, rev + 7}}},
+		{"ApplyAttributes", func() error {
+			_, err := a.ApplyAttributes(strings.NewReader(`{"/a": {"Label": "applied"}}`))
+			return err
+		}, []Event{{"/a", EventStored, rev + 8}}},
+		{"PurgeExpired", func() error {
+			a.StoreWithTTL(TextPlain("/expired", "expired"), -time.Hour)
+			_, err := a.PurgeExpired()
+			return err
+		}, []Event{{"/expired", EventStored, rev + 9}, {"/expired", EventDeleted, rev + 10}}},
+		{"EvictToSize", func() error {
+			for _, id := range []string{"/a", "/packed", "/t/z", cas} {
+				a.Pin(id)
+			}
+			_, err := a.EvictToSize(0)
+			return err
+		}, []Event{
+			{"/a", EventStored, rev + 11},
+			{"/packed", EventStored, rev + 12},
+			{"/t/z", EventStored, rev + 13},
+			{cas, EventStored, rev + 14},
+			{"/t/y", EventDeleted, rev + 15},
+		}},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("expected %s to succeed: %s", step.name, err)
+		}
+		var got []Event
+		for range step.want {
+			select {
+			case e := <-events:
+				got = append(got, e)
+			case <-time.After(time.Second):
+				t.Fatalf("expected %s to publish %v but got %v", step.name, step.want, got)
+			}
+		}
+		if !reflect.DeepEqual(step.want, got) {
+			t.Fatalf("expected %s to publish %v but got %v", step.name, step.want, got)
+		}
+	}
+}